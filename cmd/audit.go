@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+// how a caller presented its credentials
+const (
+	authCredentialHeader    = "bearer_header" // bearer token in the Authorization header
+	authCredentialQuery     = "bearer_query"  // bearer token in the "token" query parameter
+	authCredentialSignedURL = "signed_url"    // signed cover image or widget url
+)
+
+const authCredentialKey = "auth_credential" // gin context key
+
+// authentication outcomes are always recorded, whatever the current log level
+var auditLog = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+func setupAuditLogging(handler slog.Handler) {
+	auditLog = slog.New(handler).With("log_stream", "audit")
+}
+
+// credentialFingerprint identifies a token or signature in logs without revealing it
+func credentialFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+type authEvent struct {
+	credential string          // one of the authCredential* values
+	reason     string          // authSuccess, or the failure reason
+	secret     string          // the token or signature presented, which is only ever fingerprinted
+	claims     *v4jwt.V4Claims // verified claims, if any
+	err        error
+}
+
+func unverifiedClaims(token string) (string, string) {
+	// the user id and auth method a token claims, for auditing tokens that failed validation
+
+	claims := jwt.MapClaims{}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return "", ""
+	}
+
+	userID, _ := claims["userId"].(string)
+	authMethod, _ := claims["authMethod"].(string)
+
+	return userID, authMethod
+}
+
+func (p *serviceContext) auditAuth(c *gin.Context, ev authEvent) {
+	p.metrics.authOutcomes.WithLabelValues(ev.reason).Inc()
+
+	outcome := "success"
+	level := slog.LevelInfo
+
+	if ev.reason != authSuccess {
+		outcome = "failure"
+		level = slog.LevelWarn
+	}
+
+	attrs := []any{
+		"outcome", outcome,
+		"reason", ev.reason,
+		"credential", ev.credential,
+		"request_id", c.GetString(requestIDKey),
+		"route", c.FullPath(),
+		"client_ip", c.ClientIP(),
+	}
+
+	if fp := credentialFingerprint(ev.secret); fp != "" {
+		attrs = append(attrs, "fingerprint", fp)
+	}
+
+	switch {
+	case ev.claims != nil:
+		attrs = append(attrs, "user_id", ev.claims.UserID, "auth_method", ev.claims.AuthMethod.String(), "claims_verified", true)
+
+	case ev.credential != authCredentialSignedURL && ev.secret != "":
+		if userID, authMethod := unverifiedClaims(ev.secret); userID != "" {
+			attrs = append(attrs, "user_id", userID, "auth_method", authMethod, "claims_verified", false)
+		}
+	}
+
+	if ev.err != nil {
+		attrs = append(attrs, "error", ev.err.Error())
+	}
+
+	auditLog.Log(context.Background(), level, "auth "+outcome, attrs...)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type shelfBrowseBatchRequestItem struct {
+	ID    string `json:"id"`
+	Range *int   `json:"range,omitempty"`
+}
+
+type shelfBrowseBatchRequest struct {
+	Items []shelfBrowseBatchRequestItem `json:"items"`
+}
+
+type shelfBrowseBatchResponse struct {
+	Results       map[string]shelfBrowseResponse `json:"results,omitempty"`
+	TotalItems    int                            `json:"total_items"`
+	StatusCode    int                            `json:"status_code"`
+	StatusMessage string                         `json:"status_msg,omitempty"`
+	Details       []string                       `json:"details,omitempty"`
+}
+
+type searchMemoTerms struct {
+	count int
+	terms []string
+}
+
+// remembers solr lookups for the lifetime of a single (batch) request,
+// so that overlapping shelf neighborhoods are only looked up once
+type searchMemo struct {
+	items map[string]itemLookup
+	terms map[string]searchMemoTerms
+	hits  int
+}
+
+func newSearchMemo() *searchMemo {
+	return &searchMemo{
+		items: make(map[string]itemLookup),
+		terms: make(map[string]searchMemoTerms),
+	}
+}
+
+func (m *searchMemo) getItemDetails(s *searchContext, field, value string) (shelfBrowseItem, searchResponse) {
+	key := field + ":" + value
+
+	if cached, ok := m.items[key]; ok == true {
+		m.hits++
+		return cached.item, cached.resp
+	}
+
+	item, resp := s.cachedItemDetails(field, value)
+
+	// only remember definitive answers; transient failures may succeed on retry
+	if resp.err == nil || resp.status == http.StatusNotFound {
+		m.items[key] = itemLookup{item: item, resp: resp}
+	}
+
+	// a found item can also be reached by its id or either of its shelf keys
+	if resp.err == nil {
+		cfg := s.svc.config.Solr.ShelfBrowse
+		cached := itemLookup{item: item, resp: resp}
+
+		m.items["id:"+item.doc.getFirstString("id")] = cached
+		m.items[cfg.ForwardKey+":"+item.forwardKey] = cached
+		m.items[cfg.ReverseKey+":"+item.reverseKey] = cached
+	}
+
+	return item, resp
+}
+
+func (m *searchMemo) solrTerms(s *searchContext, field, key string, count int) ([]string, error) {
+	memoKey := field + ":" + key
+
+	// a previous walk from the same key covers this one if it was at least as long
+	if cached, ok := m.terms[memoKey]; ok == true && cached.count >= count {
+		m.hits++
+		terms := cached.terms
+		if len(terms) > count {
+			terms = terms[:count]
+		}
+		return terms, nil
+	}
+
+	terms, err := s.cachedTerms(field, key, count)
+
+	if err == nil {
+		m.terms[memoKey] = searchMemoTerms{count: count, terms: terms}
+	}
+
+	return terms, err
+}
+
+func (s *searchContext) handleBatchBrowseRequest() searchResponse {
+	cfg := s.svc.config.Solr.ShelfBrowse
+
+	badRequest := func(details []string) searchResponse {
+		resp := searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid request: %s", strings.Join(details, "; "))}
+		resp.data = shelfBrowseBatchResponse{StatusCode: resp.status, StatusMessage: "invalid request", Details: details}
+		return resp
+	}
+
+	var req shelfBrowseBatchRequest
+
+	if err := s.client.ginCtx.ShouldBindJSON(&req); err != nil {
+		return badRequest([]string{fmt.Sprintf("body: %s", err.Error())})
+	}
+
+	// validate request
+
+	var errs []string
+
+	if len(req.Items) == 0 {
+		errs = append(errs, "items: at least one item is required")
+	}
+
+	if len(req.Items) > cfg.MaxBatchIDs {
+		errs = append(errs, fmt.Sprintf("items: %d items is greater than the maximum of %d", len(req.Items), cfg.MaxBatchIDs))
+	}
+
+	rangeSchema := s.svc.openAPI.Components.Schemas["shelfBrowseBatchRequestItem"].Properties["range"]
+
+	seen := make(map[string]bool)
+
+	for i, item := range req.Items {
+		label := fmt.Sprintf("items[%d]", i)
+
+		switch {
+		case item.ID == "":
+			errs = append(errs, fmt.Sprintf("%s.id: missing required value", label))
+
+		case seen[item.ID] == true:
+			errs = append(errs, fmt.Sprintf("%s.id: duplicate id [%s]", label, item.ID))
+		}
+
+		seen[item.ID] = true
+
+		if item.Range != nil {
+			if msg := rangeSchema.validate(label+".range", strconv.Itoa(*item.Range)); msg != "" {
+				errs = append(errs, msg)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return badRequest(errs)
+	}
+
+	// browse each item in turn, sharing solr lookups between them,
+	// and shrinking windows as needed to stay within the global item limit.
+	// this is deliberately sequential: each window's size depends on what the
+	// earlier ones returned, and a window can only reuse lookups that earlier
+	// ones have finished.  the work per request is bounded by max_batch_ids.
+
+	s.memo = newSearchMemo()
+
+	res := shelfBrowseBatchResponse{Results: make(map[string]shelfBrowseResponse), StatusCode: http.StatusOK}
+
+	remaining := cfg.MaxBatchItems
+
+	for _, item := range req.Items {
+		limit := cfg.DefaultItems
+		if item.Range != nil {
+			limit = *item.Range
+		}
+
+		// each window holds the item itself plus up to limit items on either side
+		if maxLimit := (remaining - 1) / 2; limit > maxLimit {
+			limit = maxLimit
+		}
+
+		if limit < 1 {
+			s.warn("batch item limit reached; skipping id [%s]", item.ID)
+			res.Results[item.ID] = shelfBrowseResponse{StatusCode: http.StatusRequestEntityTooLarge, StatusMessage: "batch item limit reached"}
+			continue
+		}
+
+		s.log("id = [%s]  limit = [%d]", item.ID, limit)
+
+		itemResp := s.withStaleFallback(item.ID, limit, s.browseItem(item.ID, limit))
+
+		itemRes, _ := itemResp.data.(shelfBrowseResponse)
+
+		remaining -= len(itemRes.Items)
+		res.TotalItems += len(itemRes.Items)
+
+		res.Results[item.ID] = itemRes
+	}
+
+	s.log("batch: %d ids, %d items, %d shared lookups", len(req.Items), res.TotalItems, s.memo.hits)
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
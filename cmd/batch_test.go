@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestBatchSharesLookupsAcrossIDs(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e", "f")
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	// neighboring items, whose windows overlap
+	body := `{"items":[{"id":"c","range":2},{"id":"d","range":2}]}`
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/browse", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	s := &searchContext{svc: svc, client: &clientContext{ginCtx: c}}
+
+	resp := s.handleBatchBrowseRequest()
+
+	res, ok := resp.data.(shelfBrowseBatchResponse)
+	if resp.status != http.StatusOK || ok == false || len(res.Results) != 2 {
+		t.Fatalf("got %d %#v, want results for both ids", resp.status, resp.data)
+	}
+
+	for id, want := range map[string][]string{"c": {"a", "b", "c", "d", "e"}, "d": {"b", "c", "d", "e", "f"}} {
+		var got []string
+		for _, item := range res.Results[id].Items {
+			got = append(got, item["id"])
+		}
+
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got window %v for %s, want %v", got, id, want)
+		}
+	}
+
+	// d was already found on c's shelf, so it is never looked up by id
+	if n := shelf.selectCount(`id:"d"`); n != 0 {
+		t.Errorf("got %d lookups of d by id, want it shared from c's walk", n)
+	}
+
+	shelf.mu.Lock()
+	for q, n := range shelf.selects {
+		if n > 1 {
+			t.Errorf("got %d lookups of [%s], want one", n, q)
+		}
+	}
+	shelf.mu.Unlock()
+
+	if s.memo.hits == 0 {
+		t.Error("got no shared lookups between overlapping windows")
+	}
+}
+
+func TestBatchRejectsDuplicateIDs(t *testing.T) {
+	cfg := testConfig()
+
+	router := newTestService(t, cfg).newRouter()
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/browse", strings.NewReader(`{"items":[{"id":"a"},{"id":"b"},{"id":"a","range":2}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res shelfBrowseBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusBadRequest || len(res.Details) != 1 || res.Details[0] != "items[2].id: duplicate id [a]" {
+		t.Errorf("got %d %v, want a 400 naming the duplicate", w.Code, res.Details)
+	}
+}
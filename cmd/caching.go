@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// caches of solr lookups that are shared across requests
+type serviceResultCache struct {
+	terms *lruCache // terms walks, keyed by field, lower bound and count
+	items *lruCache // item lookups, keyed by shelf key field and value
+}
+
+// the most recently observed solr index version, refreshed at most once per interval
+type serviceIndexVersion struct {
+	mu         sync.Mutex
+	version    int64
+	known      bool
+	modified   time.Time // when the index last changed, as reported by solr, or else when we first saw this version
+	checked    time.Time
+	interval   time.Duration
+	refreshing bool // a check is in progress
+}
+
+func (p *serviceContext) initCaching() {
+	interval := integerWithMinimum(p.config.Caching.IndexVersionInterval, 1)
+
+	p.indexVersion = &serviceIndexVersion{interval: time.Duration(interval) * time.Second}
+
+	rc := p.config.Caching.Results
+	ttl := integerWithMinimum(rc.TTL, 1)
+
+	p.resultCache = &serviceResultCache{
+		terms: newLRUCache(rc.MaxEntries, rc.MaxBytes, time.Duration(ttl)*time.Second),
+		items: newLRUCache(rc.MaxEntries, rc.MaxBytes, time.Duration(ttl)*time.Second),
+	}
+
+	log.Printf("[SERVICE] cache control          = [%s]", p.config.Caching.CacheControl)
+	log.Printf("[SERVICE] index version interval = [%ds]", interval)
+	log.Printf("[SERVICE] result cache limits    = [%d entries, %d bytes, %ds ttl]", rc.MaxEntries, rc.MaxBytes, ttl)
+}
+
+func estimatedDocSize(doc *solrDocument) int {
+	// rough in-memory size of a solr document, for cache accounting
+
+	size := 64
+
+	for key, val := range *doc {
+		size += len(key) + 16
+
+		switch t := val.(type) {
+		case string:
+			size += len(t)
+
+		case []any:
+			for _, v := range t {
+				if str, ok := v.(string); ok == true {
+					size += len(str) + 16
+				}
+			}
+		}
+	}
+
+	return size
+}
+
+func (s *searchContext) cachedItemDetails(field, value string) (shelfBrowseItem, searchResponse) {
+	// only lookups by shelf key are cached
+
+	cfg := s.svc.config.Solr.ShelfBrowse
+
+	if field != cfg.ForwardKey && field != cfg.ReverseKey {
+		return s.coalescedItemDetails(field, value)
+	}
+
+	version, _ := s.getIndexVersion()
+	key := field + "\x00" + value
+
+	if val, ok := s.svc.resultCache.items.get(key, version); ok == true {
+		cached := val.(itemLookup)
+		return cached.item, cached.resp
+	}
+
+	item, resp := s.coalescedItemDetails(field, value)
+
+	// remember found items and definitive misses, but not transient failures
+	switch {
+	case resp.err == nil:
+		size := len(key) + len(item.forwardKey) + len(item.reverseKey) + estimatedDocSize(item.doc)
+		s.svc.resultCache.items.put(key, itemLookup{item: item, resp: resp}, size, version)
+
+	case resp.status == http.StatusNotFound:
+		s.svc.resultCache.items.put(key, itemLookup{item: item, resp: resp}, len(key)+64, version)
+	}
+
+	return item, resp
+}
+
+func (s *searchContext) cachedTerms(field, lower string, count int) ([]string, error) {
+	version, _ := s.getIndexVersion()
+	key := fmt.Sprintf("%s\x00%s\x00%d", field, lower, count)
+
+	if val, ok := s.svc.resultCache.terms.get(key, version); ok == true {
+		return val.([]string), nil
+	}
+
+	terms, err := s.coalescedTerms(field, lower, count)
+	if err != nil {
+		return terms, err
+	}
+
+	size := len(key) + 64
+	for _, term := range terms {
+		size += len(term) + 16
+	}
+
+	s.svc.resultCache.terms.put(key, terms, size, version)
+
+	return terms, nil
+}
+
+func (s *searchContext) getIndexVersion() (int64, bool) {
+	// returns the last known version at once.  a check that is due is made by the first caller
+	// to notice, outside the lock: in the background once a version is known, so that no
+	// request waits on solr for it, and otherwise in line, since there is nothing to return yet.
+
+	iv := s.svc.indexVersion
+
+	iv.mu.Lock()
+
+	due := iv.refreshing == false && time.Since(iv.checked) >= iv.interval
+	if due == true {
+		iv.refreshing = true
+		iv.checked = time.Now()
+	}
+
+	version, known := iv.version, iv.known
+
+	iv.mu.Unlock()
+
+	if due == false {
+		return version, known
+	}
+
+	if known == true {
+		go s.detached().refreshIndexVersion()
+		return version, known
+	}
+
+	s.refreshIndexVersion()
+
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	return iv.version, iv.known
+}
+
+func (s *searchContext) refreshIndexVersion() {
+	iv := s.svc.indexVersion
+
+	index, err := s.solrIndexVersion()
+
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	iv.refreshing = false
+
+	// on failure, keep using the last known version until the next check
+	if err != nil {
+		s.warn("could not determine solr index version: %s", err.Error())
+		return
+	}
+
+	modified, err := time.Parse(time.RFC3339, index.LastModified)
+	switch {
+	case err == nil:
+		iv.modified = modified
+
+	case iv.known == false || index.Version != iv.version:
+		iv.modified = time.Now()
+	}
+
+	iv.version = index.Version
+	iv.known = true
+}
+
+func (s *searchContext) getIndexModified() time.Time {
+	// when the index last changed; the zero time if that is not yet known
+
+	s.getIndexVersion()
+
+	iv := s.svc.indexVersion
+
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+
+	return iv.modified
+}
+
+func (s *searchContext) browseETag(format string, version int64, res shelfBrowseResponse) string {
+	// strong validator over everything that determines the response body.  it is computed
+	// from the response rather than its encoding, so that a match can skip encoding entirely.
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "format=%s\nversion=%d\ndebug=%v\n", format, version, res.Debug != nil)
+
+	for _, item := range res.Items {
+		fmt.Fprintf(h, "item=%s\n", item[fieldID])
+		for _, field := range s.svc.config.Fields {
+			fmt.Fprintf(h, "%s=%s\n", field.Name, item[field.Name])
+		}
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+func etagMatches(header, etag string) bool {
+	// If-None-Match uses the weak comparison function
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *searchContext) handleCacheValidators(format string, resp searchResponse) bool {
+	// sets caching headers for the response, and returns true if the client's copy is still current
+
+	c := s.client.ginCtx
+
+	res, ok := resp.data.(shelfBrowseResponse)
+
+	if resp.status != http.StatusOK || ok == false {
+		c.Header("Cache-Control", "no-store")
+		return false
+	}
+
+	// stale or partial responses must not be cached or validated against
+	if res.Stale == true || res.Partial == true {
+		c.Header("Cache-Control", "no-cache")
+		return false
+	}
+
+	version, known := s.getIndexVersion()
+	if known == false {
+		c.Header("Cache-Control", "no-cache")
+		return false
+	}
+
+	etag := s.browseETag(format, version, res)
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", s.svc.config.Caching.CacheControl)
+
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, etag) == true {
+		s.log("client copy is current (etag %s)", etag)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestIndexVersionRefreshDoesNotBlock(t *testing.T) {
+	var version, calls atomic.Int64
+	version.Store(1)
+
+	release := make(chan struct{})
+
+	solr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every check after the first waits until released
+		if calls.Add(1) > 1 {
+			<-release
+		}
+		fmt.Fprintf(w, `{"responseHeader":{"status":0},"index":{"version":%d,"lastModified":"2024-03-05T14:30:00Z"}}`, version.Load())
+	}))
+	defer solr.Close()
+
+	cfg := testConfig()
+	cfg.Solr.Host = solr.URL
+	cfg.Solr.Clients.HealthCheck.ReadTimeout = "5"
+
+	svc := newTestService(t, cfg)
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	// nothing is known yet, so the first check is made in line
+	if v, known := s.getIndexVersion(); v != 1 || known == false {
+		t.Fatalf("got version %d (known: %v), want 1", v, known)
+	}
+
+	if got := s.getIndexModified(); got.Equal(time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)) == false {
+		t.Errorf("got modification time %s, want the index lastModified", got)
+	}
+
+	// make the next check due while solr is slow; callers must keep getting the known version
+
+	version.Store(2)
+
+	svc.indexVersion.mu.Lock()
+	svc.indexVersion.checked = time.Time{}
+	svc.indexVersion.mu.Unlock()
+
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, _ := s.getIndexVersion(); v != 1 {
+				t.Errorf("got version %d while the check is in progress, want 1", v)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("callers waited %s for the version check", elapsed)
+	}
+
+	close(release)
+
+	// the background check eventually records the new version, having been made only once
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if v, _ := s.getIndexVersion(); v == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new index version was never recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("got %d version checks, want 2", n)
+	}
+}
+
+func TestBrowseETags(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e")
+	defer shelf.Close()
+
+	cfg := shelf.config()
+
+	router := newTestService(t, cfg).newRouter()
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := get("/api/browse/b?range=1", "")
+	etag := w.Header().Get("ETag")
+
+	if w.Code != http.StatusOK || etag == "" || strings.HasPrefix(etag, "W/") == true {
+		t.Fatalf("got %d with etag [%s], want a strong etag", w.Code, etag)
+	}
+
+	if again := get("/api/browse/b?range=1", "").Header().Get("ETag"); again != etag {
+		t.Errorf("got etag [%s] for the same response, want [%s]", again, etag)
+	}
+
+	// If-None-Match uses weak comparison, so a weakened copy of the tag still matches
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		if w := get("/api/browse/b?range=1", inm); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("got %d with %d bytes for If-None-Match [%s], want an empty 304", w.Code, w.Body.Len(), inm)
+		}
+	}
+
+	if w := get("/api/browse/b?range=1", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("got %d for a different etag, want %d", w.Code, http.StatusOK)
+	}
+
+	// other items, or the same items in another format, are other representations
+	for _, path := range []string{"/api/browse/b?range=2", "/api/browse/a?range=1", "/api/browse/b?range=1&format=csv"} {
+		if other := get(path, "").Header().Get("ETag"); other == "" || other == etag {
+			t.Errorf("got etag [%s] for %s, want one differing from [%s]", other, path, etag)
+		}
+	}
+}
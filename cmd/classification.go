@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// output item fields describing the lc classification of an item
+const (
+	fieldLCClass    = "lc_class"
+	fieldLCSubclass = "lc_subclass"
+	fieldLCLabel    = "lc_label"
+)
+
+// lc outline entry types, from broadest to narrowest
+const (
+	lcOutlineClass    = "class"
+	lcOutlineSubclass = "subclass"
+	lcOutlineRange    = "range"
+)
+
+//go:embed data/lc_outline.tsv
+var lcOutlineData []byte
+
+// outline codes: class letters, optionally followed by a class number or range of class numbers
+var lcOutlineCodeRegex = regexp.MustCompile(`^([A-Z]{1,3})(?:(\d+(?:\.\d+)?)(?:-(\d+(?:\.\d+)?))?)?$`)
+
+// the class letters and class number at the start of an lc call number, e.g. "QA76.73 .J38 2005"
+var lcCallNumberRegex = regexp.MustCompile(`^([A-Z]{1,3})\s*(\d+(?:\.\d+)?)?\b`)
+
+type lcOutlineEntry struct {
+	Type     string  `json:"type"`
+	Code     string  `json:"code"`
+	Label    string  `json:"label"`
+	letters  string  // class letters of the code
+	start    float64 // first class number in a range
+	end      float64 // last class number in a range
+	wholeEnd bool    // whether the range extends to decimal extensions of its last class number
+}
+
+// the bundled lc outline, indexed for lookups by class letters
+type lcOutline struct {
+	entries    int
+	classes    map[string]lcOutlineEntry
+	subclasses map[string]lcOutlineEntry
+	ranges     map[string][]lcOutlineEntry // widest first
+}
+
+type lcClassification struct {
+	Class     string
+	Subclass  string
+	Code      string // code of the narrowest matching outline entry
+	Label     string // label of the narrowest matching outline entry
+	Hierarchy []lcOutlineEntry
+}
+
+type classificationResponse struct {
+	CallNumber    string           `json:"call_number,omitempty"`
+	Class         string           `json:"lc_class,omitempty"`
+	Subclass      string           `json:"lc_subclass,omitempty"`
+	Code          string           `json:"code,omitempty"`
+	Label         string           `json:"lc_label,omitempty"`
+	Hierarchy     []lcOutlineEntry `json:"hierarchy,omitempty"`
+	StatusCode    int              `json:"status_code"`
+	StatusMessage string           `json:"status_msg,omitempty"`
+	Details       []string         `json:"details,omitempty"`
+}
+
+func (e lcOutlineEntry) contains(number float64) bool {
+	if number < e.start {
+		return false
+	}
+
+	if e.wholeEnd == true {
+		return number < e.end+1
+	}
+
+	return number <= e.end
+}
+
+func parseLCOutline(data []byte) (*lcOutline, error) {
+	outline := lcOutline{
+		classes:    make(map[string]lcOutlineEntry),
+		subclasses: make(map[string]lcOutlineEntry),
+		ranges:     make(map[string][]lcOutlineEntry),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cols := strings.Split(text, "\t")
+		if len(cols) != 3 {
+			return nil, fmt.Errorf("line %d: expected 3 tab-separated columns", line)
+		}
+
+		entry := lcOutlineEntry{Type: cols[0], Code: cols[1], Label: cols[2]}
+
+		m := lcOutlineCodeRegex.FindStringSubmatch(entry.Code)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: invalid code [%s]", line, entry.Code)
+		}
+
+		entry.letters = m[1]
+
+		switch entry.Type {
+		case lcOutlineClass:
+			if len(entry.letters) != 1 || m[2] != "" {
+				return nil, fmt.Errorf("line %d: class code [%s] must be a single letter", line, entry.Code)
+			}
+			outline.classes[entry.letters] = entry
+
+		case lcOutlineSubclass:
+			if m[2] != "" {
+				return nil, fmt.Errorf("line %d: subclass code [%s] must be letters only", line, entry.Code)
+			}
+			if _, ok := outline.classes[entry.letters[:1]]; ok == false {
+				return nil, fmt.Errorf("line %d: subclass [%s] precedes its class", line, entry.Code)
+			}
+			outline.subclasses[entry.letters] = entry
+
+		case lcOutlineRange:
+			if m[2] == "" {
+				return nil, fmt.Errorf("line %d: range code [%s] has no class number", line, entry.Code)
+			}
+			if _, ok := outline.subclasses[entry.letters]; ok == false {
+				return nil, fmt.Errorf("line %d: range [%s] precedes its subclass", line, entry.Code)
+			}
+
+			last := m[2]
+			if m[3] != "" {
+				last = m[3]
+			}
+
+			entry.start, _ = strconv.ParseFloat(m[2], 64)
+			entry.end, _ = strconv.ParseFloat(last, 64)
+			entry.wholeEnd = strings.Contains(last, ".") == false
+
+			if entry.end < entry.start {
+				return nil, fmt.Errorf("line %d: range [%s] ends before it starts", line, entry.Code)
+			}
+
+			outline.ranges[entry.letters] = append(outline.ranges[entry.letters], entry)
+
+		default:
+			return nil, fmt.Errorf("line %d: unknown entry type [%s]", line, entry.Type)
+		}
+
+		outline.entries++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// broader ranges come before the narrower ones they contain
+	for _, ranges := range outline.ranges {
+		sort.SliceStable(ranges, func(i, j int) bool {
+			return ranges[i].end-ranges[i].start > ranges[j].end-ranges[j].start
+		})
+	}
+
+	return &outline, nil
+}
+
+func (o *lcOutline) classify(callNumber string) (lcClassification, bool) {
+	// resolves a call number to its outline hierarchy, if it looks like an lc call number
+
+	var res lcClassification
+
+	m := lcCallNumberRegex.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(callNumber)))
+	if m == nil {
+		return res, false
+	}
+
+	class, ok := o.classes[m[1][:1]]
+	if ok == false {
+		return res, false
+	}
+
+	subclass, ok := o.subclasses[m[1]]
+	if ok == false {
+		return res, false
+	}
+
+	res.Class = class.letters
+	res.Subclass = subclass.letters
+	res.Hierarchy = []lcOutlineEntry{class, subclass}
+
+	if m[2] != "" {
+		number, _ := strconv.ParseFloat(m[2], 64)
+
+		for _, entry := range o.ranges[subclass.letters] {
+			if entry.contains(number) == true {
+				res.Hierarchy = append(res.Hierarchy, entry)
+			}
+		}
+	}
+
+	narrowest := res.Hierarchy[len(res.Hierarchy)-1]
+
+	res.Code = narrowest.Code
+	res.Label = narrowest.Label
+
+	return res, true
+}
+
+func (p *serviceContext) initClassification() {
+	outline, err := parseLCOutline(lcOutlineData)
+	if err != nil {
+		log.Printf("[SERVICE] invalid lc outline: %s", err.Error())
+		os.Exit(1)
+	}
+
+	p.lcOutline = outline
+
+	log.Printf("[SERVICE] lc outline entries        = [%d]", outline.entries)
+	log.Printf("[SERVICE] classification call field = [%s]", p.config.Classification.CallNumberField)
+}
+
+func (s *searchContext) classifyItems(items []shelfBrowseItem, itemMap []map[string]string) []shelfBrowseSection {
+	// adds the lc classification of each item to its output fields, and
+	// returns the points along the shelf at which the classification changes
+
+	field := s.svc.config.Classification.CallNumberField
+	if field == "" {
+		return nil
+	}
+
+	var sections []shelfBrowseSection
+
+	current := ""
+
+	for i, item := range items {
+		lc, ok := s.svc.lcOutline.classify(item.doc.getFirstString(field))
+
+		// unclassified items are treated as part of the surrounding section
+		if ok == false {
+			continue
+		}
+
+		for name, val := range map[string]string{fieldLCClass: lc.Class, fieldLCSubclass: lc.Subclass, fieldLCLabel: lc.Label} {
+			if _, exists := itemMap[i][name]; exists == false {
+				itemMap[i][name] = val
+			}
+		}
+
+		if lc.Code != current {
+			sections = append(sections, shelfBrowseSection{StartIndex: i, Class: lc.Class, Subclass: lc.Subclass, Code: lc.Code, Label: lc.Label})
+			current = lc.Code
+		}
+	}
+
+	return sections
+}
+
+func (s *searchContext) handleClassificationRequest() searchResponse {
+	// call number is required (already validated against the api description)
+	callNumber := s.client.ginCtx.Query("call_number")
+
+	s.log("call number = [%s]", callNumber)
+
+	lc, ok := s.svc.lcOutline.classify(callNumber)
+
+	if ok == false {
+		err := fmt.Errorf("call number is not in the lc outline")
+		s.warn("%s", err.Error())
+		resp := searchResponse{status: http.StatusNotFound, err: err}
+		resp.data = classificationResponse{CallNumber: callNumber, StatusCode: resp.status, StatusMessage: err.Error()}
+		return resp
+	}
+
+	res := classificationResponse{
+		CallNumber: callNumber,
+		Class:      lc.Class,
+		Subclass:   lc.Subclass,
+		Code:       lc.Code,
+		Label:      lc.Label,
+		Hierarchy:  lc.Hierarchy,
+		StatusCode: http.StatusOK,
+	}
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
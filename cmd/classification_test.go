@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClassifyCallNumbers(t *testing.T) {
+	outline, err := parseLCOutline(lcOutlineData)
+	if err != nil {
+		t.Fatalf("bundled outline: %s", err.Error())
+	}
+
+	tests := []struct {
+		callNumber string
+		ok         bool
+		class      string
+		subclass   string
+		code       string
+	}{
+		// class letters with no class number stop at the subclass
+		{callNumber: "Q", ok: true, class: "Q", subclass: "Q", code: "Q"},
+
+		// space between the class letters and number is optional
+		{callNumber: "B 72 .R8", ok: true, class: "B", subclass: "B", code: "B69-789"},
+
+		// narrowest of several nested ranges
+		{callNumber: "Q335 .R86 2010", ok: true, class: "Q", subclass: "Q", code: "Q334-342"},
+		{callNumber: "QA76.73 .J38 2005", ok: true, class: "Q", subclass: "QA", code: "QA75.5-76.95"},
+		{callNumber: "QA76.76 .O63", ok: true, class: "Q", subclass: "QA", code: "QA76.75-76.765"},
+		{callNumber: "qa76.76 .o63", ok: true, class: "Q", subclass: "QA", code: "QA76.75-76.765"},
+
+		// a decimal upper bound is exact, a whole one includes its decimal extensions
+		{callNumber: "QA76.95 .B3", ok: true, class: "Q", subclass: "QA", code: "QA75.5-76.95"},
+		{callNumber: "QA76.96 .B3", ok: true, class: "Q", subclass: "QA", code: "QA71-90"},
+		{callNumber: "QA90.5 .C5", ok: true, class: "Q", subclass: "QA", code: "QA71-90"},
+		{callNumber: "QA75.5", ok: true, class: "Q", subclass: "QA", code: "QA75.5-76.95"},
+		{callNumber: "QA75.4", ok: true, class: "Q", subclass: "QA", code: "QA71-90"},
+
+		// adjacent ranges, and gaps between them
+		{callNumber: "PR6049.9 .W5", ok: true, class: "P", subclass: "PR", code: "PR6000-6049"},
+		{callNumber: "PR6050 .A2", ok: true, class: "P", subclass: "PR", code: "PR6050-6076"},
+		{callNumber: "PR6077", ok: true, class: "P", subclass: "PR", code: "PR"},
+		{callNumber: "QA70.9", ok: true, class: "Q", subclass: "QA", code: "QA"},
+
+		// not lc call numbers
+		{callNumber: "", ok: false},
+		{callNumber: "823.914 R884", ok: false},
+		{callNumber: "Microfilm 1234", ok: false},
+		{callNumber: "QZ 200 .S5", ok: false},
+		{callNumber: "X123", ok: false},
+	}
+
+	for _, test := range tests {
+		lc, ok := outline.classify(test.callNumber)
+
+		if ok != test.ok {
+			t.Errorf("%q: got classified %v, want %v", test.callNumber, ok, test.ok)
+			continue
+		}
+
+		if ok == false {
+			continue
+		}
+
+		if lc.Class != test.class || lc.Subclass != test.subclass || lc.Code != test.code {
+			t.Errorf("%q: got %s/%s/%s, want %s/%s/%s", test.callNumber, lc.Class, lc.Subclass, lc.Code, test.class, test.subclass, test.code)
+		}
+
+		if len(lc.Hierarchy) < 2 || lc.Hierarchy[0].Code != test.class || lc.Hierarchy[1].Code != test.subclass {
+			t.Errorf("%q: got hierarchy %v, want it to start with the class and subclass", test.callNumber, lc.Hierarchy)
+		}
+
+		if lc.Hierarchy[len(lc.Hierarchy)-1].Code != lc.Code {
+			t.Errorf("%q: got hierarchy %v, want it to end with %s", test.callNumber, lc.Hierarchy, lc.Code)
+		}
+	}
+}
+
+func TestClassifyItemSections(t *testing.T) {
+	svc := newTestService(t, testConfig())
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	field := svc.config.Classification.CallNumberField
+
+	callNumbers := []string{
+		"QA76.73 .J38 2005",
+		"QA76.9 .D3",
+		"QA76.76 .O63", // adjacent on the shelf, but in a narrower range
+		"Microfilm 1234",
+		"QA76.765 .S6",
+		"QA77 .H4",
+	}
+
+	var items []shelfBrowseItem
+	var itemMap []map[string]string
+
+	for _, callNumber := range callNumbers {
+		doc := solrDocument{field: []any{callNumber}}
+		items = append(items, shelfBrowseItem{doc: &doc})
+		itemMap = append(itemMap, map[string]string{})
+	}
+
+	sections := s.classifyItems(items, itemMap)
+
+	want := []shelfBrowseSection{
+		{StartIndex: 0, Code: "QA75.5-76.95"},
+		{StartIndex: 2, Code: "QA76.75-76.765"},
+		{StartIndex: 5, Code: "QA71-90"},
+	}
+
+	if len(sections) != len(want) {
+		t.Fatalf("got sections %v, want %v", sections, want)
+	}
+
+	for i := range want {
+		if sections[i].StartIndex != want[i].StartIndex || sections[i].Code != want[i].Code {
+			t.Errorf("section %d: got %d/%s, want %d/%s", i, sections[i].StartIndex, sections[i].Code, want[i].StartIndex, want[i].Code)
+		}
+
+		if sections[i].Class != "Q" || sections[i].Subclass != "QA" || sections[i].Label == "" {
+			t.Errorf("section %d: got %s/%s [%s], want a labelled Q/QA section", i, sections[i].Class, sections[i].Subclass, sections[i].Label)
+		}
+	}
+
+	if _, ok := itemMap[3][fieldLCClass]; ok == true {
+		t.Errorf("got lc fields %v on an item that is not lc classified", itemMap[3])
+	}
+
+	if itemMap[2][fieldLCClass] != "Q" || itemMap[2][fieldLCSubclass] != "QA" || itemMap[2][fieldLCLabel] != sections[1].Label {
+		t.Errorf("got lc fields %v, want those of its section", itemMap[2])
+	}
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,7 +17,8 @@ type clientOpts struct {
 }
 
 type clientContext struct {
-	reqID  string          // internally generated
+	reqID  string          // the caller's X-Request-ID, or internally generated
+	route  string          // matched route
 	start  time.Time       // internally set
 	opts   clientOpts      // options set by client
 	claims *v4jwt.V4Claims // information about this user
@@ -40,7 +41,13 @@ func (c *clientContext) init(p *serviceContext, ctx *gin.Context) {
 	c.ginCtx = ctx
 
 	c.start = time.Now()
-	c.reqID = fmt.Sprintf("%08x", p.randomSource.Uint32())
+	c.route = ctx.FullPath()
+
+	if reqID, ok := ctx.Get(requestIDKey); ok == true {
+		c.reqID = reqID.(string)
+	} else {
+		c.reqID = newRequestID()
+	}
 
 	// get claims, if any
 	if val, ok := ctx.Get("claims"); ok == true {
@@ -54,7 +61,8 @@ func (c *clientContext) init(p *serviceContext, ctx *gin.Context) {
 func (c *clientContext) logRequest() {
 	query := ""
 	if c.ginCtx.Request.URL.RawQuery != "" {
-		query = fmt.Sprintf("?%s", c.ginCtx.Request.URL.RawQuery)
+		// never log tokens or signatures passed as query parameters
+		query = fmt.Sprintf("?%s", redactedQuery(c.ginCtx.Request.URL.Query()).Encode())
 	}
 
 	claimsStr := ""
@@ -66,23 +74,11 @@ func (c *clientContext) logRequest() {
 }
 
 func (c *clientContext) logResponse(resp searchResponse) {
-	msg := fmt.Sprintf("[RESPONSE] status: %d", resp.status)
-
-	if resp.err != nil {
-		msg = msg + fmt.Sprintf(", error: %s", resp.err.Error())
-	}
-
-	c.log(msg)
-}
-
-func (c *clientContext) printf(prefix, format string, args ...interface{}) {
-	str := fmt.Sprintf(format, args...)
+	// the request is logged once it completes (see requestHandler), with any error added here
 
-	if prefix != "" {
-		str = strings.Join([]string{prefix, str}, " ")
+	if resp.err != nil && c.ginCtx != nil {
+		c.ginCtx.Set(requestErrorKey, resp.err)
 	}
-
-	log.Printf("[%s] %s", c.reqID, str)
 }
 
 func (c *clientContext) log(format string, args ...interface{}) {
@@ -90,13 +86,25 @@ func (c *clientContext) log(format string, args ...interface{}) {
 		return
 	}
 
-	c.printf("", format, args...)
+	c.logAt(slog.LevelInfo, format, args...)
+}
+
+func (c *clientContext) debug(format string, args ...interface{}) {
+	c.logAt(slog.LevelDebug, format, args...)
 }
 
 func (c *clientContext) err(format string, args ...interface{}) {
-	c.printf("ERROR:", format, args...)
+	c.logAt(slog.LevelError, format, args...)
 }
 
 func (c *clientContext) warn(format string, args ...interface{}) {
-	c.printf("WARNING:", format, args...)
+	c.logAt(slog.LevelWarn, format, args...)
+}
+
+func (c *clientContext) logSolr(level slog.Level, msg, client string, elapsedMS int64, attrs ...any) {
+	// solr timings, with consistent keys
+
+	attrs = append([]any{"solr_client", client, "solr_elapsed_ms", elapsedMS}, attrs...)
+
+	slog.Log(context.Background(), level, msg, c.logAttrs(attrs...)...)
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+)
+
+// a shared execution panicked; its callers get this instead of the process going down
+var errCoalescedPanic = errors.New("internal error")
+
+type coalesceCall struct {
+	done    chan struct{}
+	val     any
+	err     error
+	callers int
+}
+
+// collapses concurrent calls with the same key into a single execution.
+// the execution is detached from any one caller, so that a caller giving up
+// does not affect the others; each caller only waits as long as its own context allows.
+type coalesceGroup struct {
+	mu    sync.Mutex
+	calls map[string]*coalesceCall
+}
+
+func newCoalesceGroup() *coalesceGroup {
+	return &coalesceGroup{calls: make(map[string]*coalesceCall)}
+}
+
+func (g *coalesceGroup) do(ctx context.Context, key string, fn func() (any, error)) (any, bool, error) {
+	// returns the result, whether it was shared with an earlier caller, and any error
+
+	g.mu.Lock()
+
+	call, shared := g.calls[key]
+
+	if shared == true {
+		call.callers++
+	} else {
+		call = &coalesceCall{done: make(chan struct{}), callers: 1}
+		g.calls[key] = call
+
+		go func() {
+			// runs outside gin's recovery middleware, so recover here
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("panic in shared execution", "key", key, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+					call.val, call.err = nil, fmt.Errorf("%w: %v", errCoalescedPanic, r)
+				}
+
+				g.mu.Lock()
+				delete(g.calls, key)
+				g.mu.Unlock()
+
+				close(call.done)
+			}()
+
+			call.val, call.err = fn()
+		}()
+	}
+
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, shared, call.err
+
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+// in-flight groups for each kind of shared computation
+type serviceCoalescing struct {
+	browses *coalesceGroup
+	terms   *coalesceGroup
+	items   *coalesceGroup
+}
+
+func coalesceErrorStatus(err error) int {
+	// callers either gave up waiting, or the shared execution failed outright
+
+	if errors.Is(err, errCoalescedPanic) == true {
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusServiceUnavailable
+}
+
+func (p *serviceContext) initCoalescing() {
+	p.coalescing = &serviceCoalescing{
+		browses: newCoalesceGroup(),
+		terms:   newCoalesceGroup(),
+		items:   newCoalesceGroup(),
+	}
+}
+
+func (s *searchContext) context() context.Context {
+	if s.client.ginCtx == nil {
+		return context.Background()
+	}
+
+	return s.client.ginCtx.Request.Context()
+}
+
+func (s *searchContext) detached() *searchContext {
+	// a search context for work that may outlive this request.
+	// it logs as this request, but holds no reference to the (reusable) gin context.
+
+	cl := *s.client
+	cl.ginCtx = nil
+
+	// spans started for the work still belong to this request's trace
+	return &searchContext{svc: s.svc, client: &cl, trace: context.WithoutCancel(s.traceContext())}
+}
+
+func (s *searchContext) coalescedBrowse(id string, limit int) searchResponse {
+	// debug output differs, so only share with callers making the same choice
+	key := id + "\x00" + strconv.Itoa(limit) + "\x00" + strconv.FormatBool(s.client.opts.debug)
+
+	d := s.detached()
+
+	val, shared, err := s.svc.coalescing.browses.do(s.context(), key, func() (any, error) {
+		return d.browseItem(id, limit), nil
+	})
+
+	if err != nil {
+		s.warn("shared browse failed: %s", err.Error())
+		resp := searchResponse{status: coalesceErrorStatus(err), err: err}
+		resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: err.Error()}
+		return resp
+	}
+
+	if shared == true {
+		s.log("joined in-flight browse for id [%s]", id)
+	}
+
+	return val.(searchResponse)
+}
+
+func (s *searchContext) coalescedItemDetails(field, value string) (shelfBrowseItem, searchResponse) {
+	key := field + "\x00" + value
+
+	d := s.detached()
+
+	val, shared, err := s.svc.coalescing.items.do(s.context(), key, func() (any, error) {
+		item, resp := d.lookupItemDetails(field, value)
+		return itemLookup{item: item, resp: resp}, nil
+	})
+
+	if err != nil {
+		return shelfBrowseItem{}, searchResponse{status: coalesceErrorStatus(err), err: err}
+	}
+
+	if shared == true {
+		s.log("joined in-flight item lookup for %s", key)
+	}
+
+	res := val.(itemLookup)
+
+	return res.item, res.resp
+}
+
+func (s *searchContext) coalescedTerms(field, lower string, count int) ([]string, error) {
+	key := field + "\x00" + lower + "\x00" + strconv.Itoa(count)
+
+	d := s.detached()
+
+	val, shared, err := s.svc.coalescing.terms.do(s.context(), key, func() (any, error) {
+		return d.solrTermsQuery(field, lower, count)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if shared == true {
+		s.log("joined in-flight terms walk for %s", key)
+	}
+
+	return val.([]string), nil
+}
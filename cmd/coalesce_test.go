@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCoalesceRecoversPanics(t *testing.T) {
+	g := newCoalesceGroup()
+
+	_, _, err := g.do(context.Background(), "key", func() (any, error) {
+		var doc solrDocument
+		doc["field"] = "panics on a nil map"
+		return nil, nil
+	})
+
+	if errors.Is(err, errCoalescedPanic) == false {
+		t.Fatalf("got error %v, want a recovered panic", err)
+	}
+
+	if status := coalesceErrorStatus(err); status != http.StatusInternalServerError {
+		t.Errorf("got status %d for a panic, want %d", status, http.StatusInternalServerError)
+	}
+
+	// the failed execution must not linger for later callers
+	val, shared, err := g.do(context.Background(), "key", func() (any, error) {
+		return "ok", nil
+	})
+
+	if err != nil || shared == true || val != "ok" {
+		t.Errorf("got (%v, %v, %v) after a panic, want a fresh execution", val, shared, err)
+	}
+}
+
+func testCallerContext(svc *serviceContext, ctx context.Context) *searchContext {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	return &searchContext{svc: svc, client: &clientContext{ginCtx: c}}
+}
+
+func testCoalescedCallers(t *testing.T, shelf *testShelf, svc *serviceContext, group *coalesceGroup, key string, call func(s *searchContext) error) {
+	// starts several identical calls while solr is held up, then cancels the first caller
+	// before letting solr answer.  the others must all get the one shared result.
+
+	t.Helper()
+
+	const callers = 5
+
+	release := shelf.holdRequests()
+
+	errs := make([]error, callers)
+	done := make([]chan struct{}, callers)
+	cancels := make([]context.CancelFunc, callers)
+
+	for i := range errs {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		s := testCallerContext(svc, ctx)
+
+		done[i] = make(chan struct{})
+		cancels[i] = cancel
+
+		go func(i int) {
+			defer close(done[i])
+			errs[i] = call(s)
+		}(i)
+	}
+
+	// wait until every caller has joined the execution
+	joined := func() bool {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+
+		call := group.calls[key]
+
+		return call != nil && call.callers == callers
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); joined() == false; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("callers did not join a single execution of [%q]", key)
+		}
+	}
+
+	// a caller giving up returns at once, without waiting for solr
+	cancels[0]()
+
+	select {
+	case <-done[0]:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled caller did not return")
+	}
+
+	close(release)
+
+	for i := range done {
+		<-done[i]
+	}
+
+	if errors.Is(errs[0], context.Canceled) == false {
+		t.Errorf("got error %v for the cancelled caller, want %v", errs[0], context.Canceled)
+	}
+
+	for i, err := range errs[1:] {
+		if err != nil {
+			t.Errorf("caller %d failed: %s", i+1, err.Error())
+		}
+	}
+}
+
+func TestCoalescedBrowses(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e")
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	testCoalescedCallers(t, shelf, svc, svc.coalescing.browses, "c\x002\x00false", func(s *searchContext) error {
+		resp := s.coalescedBrowse("c", 2)
+		if resp.err == nil && len(resp.data.(shelfBrowseResponse).Items) != 5 {
+			return errors.New("incomplete window")
+		}
+		return resp.err
+	})
+
+	if n := shelf.selectCount(`id:"c"`); n != 1 {
+		t.Errorf("got %d browse executions, want 1", n)
+	}
+}
+
+func TestCoalescedTermsWalks(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e")
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	lower := testForwardKey(20)
+
+	testCoalescedCallers(t, shelf, svc, svc.coalescing.terms, "shelfkey\x00"+lower+"\x003", func(s *searchContext) error {
+		terms, err := s.coalescedTerms("shelfkey", lower, 3)
+		if err == nil && len(terms) != 3 {
+			return errors.New("incomplete terms")
+		}
+		return err
+	})
+
+	if n := shelf.termsCount("shelfkey", lower); n != 1 {
+		t.Errorf("got %d terms walk executions, want 1", n)
+	}
+}
+
+func TestCoalescedItemLookups(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e")
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	key := testForwardKey(30)
+
+	testCoalescedCallers(t, shelf, svc, svc.coalescing.items, "shelfkey\x00"+key, func(s *searchContext) error {
+		item, resp := s.coalescedItemDetails("shelfkey", key)
+		if resp.err == nil && item.doc.getFirstString("id") != "c" {
+			return errors.New("wrong item")
+		}
+		return resp.err
+	})
+
+	if n := shelf.selectCount(`shelfkey:"` + key + `"`); n != 1 {
+		t.Errorf("got %d item lookup executions, want 1", n)
+	}
+}
@@ -24,6 +24,11 @@ type serviceConfigSolrClient struct {
 	ReadTimeout string `json:"read_timeout,omitempty"`
 }
 
+type serviceConfigSolrAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
 type serviceConfigSolrClients struct {
 	Service     serviceConfigSolrClient `json:"service,omitempty"`
 	HealthCheck serviceConfigSolrClient `json:"healthcheck,omitempty"`
@@ -31,28 +36,76 @@ type serviceConfigSolrClients struct {
 }
 
 type serviceConfigSolrShelfBrowse struct {
-	ForwardKey   string `json:"forward_key,omitempty"`
-	ReverseKey   string `json:"reverse_key,omitempty"`
-	DefaultItems int    `json:"default_items,omitempty"`
-	MaxItems     int    `json:"max_items,omitempty"`
+	ForwardKey    string `json:"forward_key,omitempty"`
+	ReverseKey    string `json:"reverse_key,omitempty"`
+	DefaultItems  int    `json:"default_items,omitempty"`
+	MaxItems      int    `json:"max_items,omitempty"`
+	MaxBatchIDs   int    `json:"max_batch_ids,omitempty"`
+	MaxBatchItems int    `json:"max_batch_items,omitempty"`
+	MaxTerms      int    `json:"max_terms,omitempty"`
+	MaxVirtualIDs int    `json:"max_virtual_ids,omitempty"`
+}
+
+type serviceConfigCoverProvider struct {
+	Name      string `json:"name,omitempty"`
+	Type      string `json:"type,omitempty"`
+	URLPrefix string `json:"url_prefix,omitempty"`
+	Size      string `json:"size,omitempty"`
+}
+
+type serviceConfigCoverProxy struct {
+	PublicURL     string `json:"public_url,omitempty"`
+	ConnTimeout   string `json:"conn_timeout,omitempty"`
+	ReadTimeout   string `json:"read_timeout,omitempty"`
+	MaxEntries    int    `json:"max_entries,omitempty"`
+	MaxBytes      int    `json:"max_bytes,omitempty"`
+	MaxImageBytes int    `json:"max_image_bytes,omitempty"`
+	TTL           string `json:"ttl,omitempty"`
+}
+
+type serviceConfigCoverParam struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+type serviceConfigCoverDocType struct {
+	DocType string                    `json:"doc_type,omitempty"`
+	Pools   []string                  `json:"pools,omitempty"`
+	Formats []string                  `json:"formats,omitempty"`
+	Params  []serviceConfigCoverParam `json:"params,omitempty"`
+}
+
+type serviceConfigCoverChain struct {
+	Pools     []string `json:"pools,omitempty"`
+	Formats   []string `json:"formats,omitempty"`
+	Providers []string `json:"providers,omitempty"`
 }
 
 type serviceConfigCoverImages struct {
-	URLPrefix    string   `json:"url_prefix,omitempty"`
-	IDField      string   `json:"id_field,omitempty"`
-	TitleField   string   `json:"title_field,omitempty"`
-	AuthorFields []string `json:"author_fields,omitempty"`
-	ISBNField    string   `json:"isbn_field,omitempty"`
-	LCCNField    string   `json:"lccn_field,omitempty"`
-	OCLCField    string   `json:"oclc_field,omitempty"`
-	PoolField    string   `json:"pool_field,omitempty"`
-	UPCField     string   `json:"upc_field,omitempty"`
-	MusicPool    string   `json:"music_pool,omitempty"`
+	URLPrefix    string                       `json:"url_prefix,omitempty"`
+	IDField      string                       `json:"id_field,omitempty"`
+	TitleField   string                       `json:"title_field,omitempty"`
+	AuthorFields []string                     `json:"author_fields,omitempty"`
+	ISBNField    string                       `json:"isbn_field,omitempty"`
+	LCCNField    string                       `json:"lccn_field,omitempty"`
+	OCLCField    string                       `json:"oclc_field,omitempty"`
+	PoolField    string                       `json:"pool_field,omitempty"`
+	UPCField     string                       `json:"upc_field,omitempty"`
+	ISSNField    string                       `json:"issn_field,omitempty"`
+	MusicPool    string                       `json:"music_pool,omitempty"`
+	SigningKey   string                       `json:"signing_key,omitempty"`
+	SignatureTTL string                       `json:"signature_ttl,omitempty"`
+	FormatField  string                       `json:"format_field,omitempty"`
+	DocTypes     []serviceConfigCoverDocType  `json:"doc_types,omitempty"`
+	Providers    []serviceConfigCoverProvider `json:"providers,omitempty"`
+	Chains       []serviceConfigCoverChain    `json:"chains,omitempty"`
+	Proxy        serviceConfigCoverProxy      `json:"proxy,omitempty"`
 }
 
 type serviceConfigSolr struct {
 	Host        string                       `json:"host,omitempty"`
 	Core        string                       `json:"core,omitempty"`
+	Auth        serviceConfigSolrAuth        `json:"auth,omitempty"`
 	Clients     serviceConfigSolrClients     `json:"clients,omitempty"`
 	Params      serviceConfigSolrParams      `json:"params,omitempty"`
 	ShelfBrowse serviceConfigSolrShelfBrowse `json:"shelf_browse,omitempty"`
@@ -60,15 +113,72 @@ type serviceConfigSolr struct {
 }
 
 type serviceConfigField struct {
-	Name  string `json:"name,omitempty"`
-	Field string `json:"field,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Normalize string `json:"normalize,omitempty"`
+}
+
+type serviceConfigFormats struct {
+	RecordURLPrefix string `json:"record_url_prefix,omitempty"`
+	FeedURLPrefix   string `json:"feed_url_prefix,omitempty"`
+}
+
+type serviceConfigWidget struct {
+	AuthMode       string   `json:"auth_mode,omitempty"`
+	FrameAncestors []string `json:"frame_ancestors,omitempty"`
+	SigningKey     string   `json:"signing_key,omitempty"`
+	SignatureTTL   string   `json:"signature_ttl,omitempty"`
+}
+
+type serviceConfigClassification struct {
+	CallNumberField string `json:"call_number_field,omitempty"`
+}
+
+type serviceConfigResultCache struct {
+	MaxEntries int    `json:"max_entries,omitempty"`
+	MaxBytes   int    `json:"max_bytes,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+}
+
+type serviceConfigStaleStore struct {
+	MaxAge     string `json:"max_age,omitempty"`
+	MaxEntries int    `json:"max_entries,omitempty"`
+	MaxBytes   int    `json:"max_bytes,omitempty"`
+}
+
+type serviceConfigCaching struct {
+	CacheControl         string                   `json:"cache_control,omitempty"`
+	IndexVersionEndpoint string                   `json:"index_version_endpoint,omitempty"`
+	IndexVersionInterval string                   `json:"index_version_interval,omitempty"`
+	Results              serviceConfigResultCache `json:"results,omitempty"`
+	Stale                serviceConfigStaleStore  `json:"stale,omitempty"`
+}
+
+type serviceConfigTracing struct {
+	Exporter    string  `json:"exporter,omitempty"`
+	Endpoint    string  `json:"endpoint,omitempty"`
+	Insecure    bool    `json:"insecure,omitempty"`
+	SampleRatio float64 `json:"sample_ratio,omitempty"`
+	ServiceName string  `json:"service_name,omitempty"`
+}
+
+type serviceConfigLogging struct {
+	Level  string `json:"level,omitempty"`
+	Format string `json:"format,omitempty"`
 }
 
 type serviceConfig struct {
-	Port   string               `json:"port,omitempty"`
-	JWTKey string               `json:"jwt_key,omitempty"`
-	Solr   serviceConfigSolr    `json:"solr,omitempty"`
-	Fields []serviceConfigField `json:"fields,omitempty"`
+	Port           string                      `json:"port,omitempty"`
+	JWTKey         string                      `json:"jwt_key,omitempty"`
+	Solr           serviceConfigSolr           `json:"solr,omitempty"`
+	Fields         []serviceConfigField        `json:"fields,omitempty"`
+	Formats        serviceConfigFormats        `json:"formats,omitempty"`
+	Widget         serviceConfigWidget         `json:"widget,omitempty"`
+	Caching        serviceConfigCaching        `json:"caching,omitempty"`
+	Classification serviceConfigClassification `json:"classification,omitempty"`
+	Tracing        serviceConfigTracing        `json:"tracing,omitempty"`
+	Logging        serviceConfigLogging        `json:"logging,omitempty"`
+	sources        configSources               // internally set; where each value came from
 }
 
 func getSortedJSONEnvVars() []string {
@@ -86,8 +196,181 @@ func getSortedJSONEnvVars() []string {
 	return keys
 }
 
+func intWithDefault(val *int, def int) {
+	if *val <= 0 {
+		*val = def
+	}
+}
+
+func (cfg *serviceConfig) applyDefaults() {
+	// fill in optional values that were not configured
+
+	intWithDefault(&cfg.Solr.ShelfBrowse.MaxBatchIDs, 25)
+	intWithDefault(&cfg.Solr.ShelfBrowse.MaxBatchItems, 250)
+	intWithDefault(&cfg.Solr.ShelfBrowse.MaxTerms, 1000)
+	intWithDefault(&cfg.Solr.ShelfBrowse.MaxVirtualIDs, 100)
+
+	// the default range is used without validation, so it cannot exceed the maximum
+	if cfg.Solr.ShelfBrowse.DefaultItems > cfg.Solr.ShelfBrowse.MaxItems {
+		cfg.Solr.ShelfBrowse.DefaultItems = cfg.Solr.ShelfBrowse.MaxItems
+	}
+
+	if cfg.Caching.CacheControl == "" {
+		cfg.Caching.CacheControl = "private, max-age=60"
+	}
+
+	if cfg.Caching.IndexVersionEndpoint == "" {
+		cfg.Caching.IndexVersionEndpoint = "admin/luke"
+	}
+
+	if cfg.Caching.IndexVersionInterval == "" {
+		cfg.Caching.IndexVersionInterval = "30"
+	}
+
+	intWithDefault(&cfg.Caching.Results.MaxEntries, 20000)
+	intWithDefault(&cfg.Caching.Results.MaxBytes, 64*1024*1024)
+
+	if cfg.Caching.Results.TTL == "" {
+		cfg.Caching.Results.TTL = "3600"
+	}
+
+	intWithDefault(&cfg.Caching.Stale.MaxEntries, 5000)
+	intWithDefault(&cfg.Caching.Stale.MaxBytes, 32*1024*1024)
+
+	if cfg.Caching.Stale.MaxAge == "" {
+		cfg.Caching.Stale.MaxAge = "86400"
+	}
+
+	// a framed page cannot send an authorization header, so the token goes in the url
+	if cfg.Widget.AuthMode == "" {
+		cfg.Widget.AuthMode = widgetAuthQuery
+	}
+
+	if len(cfg.Widget.FrameAncestors) == 0 {
+		cfg.Widget.FrameAncestors = []string{"'self'"}
+	}
+
+	if cfg.Widget.SignatureTTL == "" {
+		cfg.Widget.SignatureTTL = "1800"
+	}
+
+	// cover images come from our own service, unless told otherwise
+
+	if len(cfg.Solr.CoverImages.Providers) == 0 {
+		cfg.Solr.CoverImages.Providers = []serviceConfigCoverProvider{{Name: coverProviderVirgo, Type: coverProviderVirgo}}
+	}
+
+	for i := range cfg.Solr.CoverImages.Providers {
+		provider := &cfg.Solr.CoverImages.Providers[i]
+
+		if provider.URLPrefix == "" {
+			switch provider.Type {
+			case coverProviderVirgo:
+				provider.URLPrefix = cfg.Solr.CoverImages.URLPrefix
+
+			case coverProviderOpenLibrary:
+				provider.URLPrefix = "https://covers.openlibrary.org/b"
+
+			case coverProviderGoogleBooks:
+				provider.URLPrefix = "https://books.google.com/books/content"
+			}
+		}
+
+		if provider.Type == coverProviderOpenLibrary && provider.Size == "" {
+			provider.Size = "M"
+		}
+	}
+
+	// by default, every record tries every provider, in configured order
+	if len(cfg.Solr.CoverImages.Chains) == 0 {
+		var names []string
+		for _, provider := range cfg.Solr.CoverImages.Providers {
+			names = append(names, provider.Name)
+		}
+		cfg.Solr.CoverImages.Chains = []serviceConfigCoverChain{{Providers: names}}
+	}
+
+	// the cover image service distinguishes music from everything else, unless told otherwise
+	if len(cfg.Solr.CoverImages.DocTypes) == 0 {
+		ids := []serviceConfigCoverParam{{Value: normalizeISBN}, {Value: normalizeOCLC}, {Value: normalizeLCCN}, {Value: normalizeUPC}}
+
+		if cfg.Solr.CoverImages.MusicPool != "" {
+			cfg.Solr.CoverImages.DocTypes = append(cfg.Solr.CoverImages.DocTypes, serviceConfigCoverDocType{
+				DocType: "music",
+				Pools:   []string{cfg.Solr.CoverImages.MusicPool},
+				Params:  append([]serviceConfigCoverParam{{Name: "artist_name", Value: coverValueAuthor}, {Name: "album_name", Value: coverValueTitle}}, ids...),
+			})
+		}
+
+		cfg.Solr.CoverImages.DocTypes = append(cfg.Solr.CoverImages.DocTypes, serviceConfigCoverDocType{
+			DocType: "non_music",
+			Params:  append([]serviceConfigCoverParam{{Value: coverValueTitle}}, ids...),
+		})
+	}
+
+	// parameters are named after their values, unless told otherwise
+	for i := range cfg.Solr.CoverImages.DocTypes {
+		for j := range cfg.Solr.CoverImages.DocTypes[i].Params {
+			if param := &cfg.Solr.CoverImages.DocTypes[i].Params[j]; param.Name == "" {
+				param.Name = param.Value
+			}
+		}
+	}
+
+	if cfg.Solr.CoverImages.SignatureTTL == "" {
+		cfg.Solr.CoverImages.SignatureTTL = "3600"
+	}
+
+	proxy := &cfg.Solr.CoverImages.Proxy
+
+	if proxy.ConnTimeout == "" {
+		proxy.ConnTimeout = "2"
+	}
+
+	if proxy.ReadTimeout == "" {
+		proxy.ReadTimeout = "5"
+	}
+
+	intWithDefault(&proxy.MaxEntries, 2000)
+	intWithDefault(&proxy.MaxBytes, 64*1024*1024)
+	intWithDefault(&proxy.MaxImageBytes, 2*1024*1024)
+
+	if proxy.TTL == "" {
+		proxy.TTL = "86400"
+	}
+
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = "info"
+	}
+
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = loggingFormatJSON
+	}
+
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = tracingExporterNone
+	}
+
+	if cfg.Tracing.SampleRatio <= 0 || cfg.Tracing.SampleRatio > 1 {
+		cfg.Tracing.SampleRatio = 1
+	}
+
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "virgo4-shelf-browse-ws"
+	}
+
+	// classify by the call number output field, unless told otherwise
+	if cfg.Classification.CallNumberField == "" {
+		for _, field := range cfg.Fields {
+			if field.Name == fieldCallNumber {
+				cfg.Classification.CallNumberField = field.Field
+			}
+		}
+	}
+}
+
 func loadConfig() *serviceConfig {
-	cfg := serviceConfig{}
+	cfg := serviceConfig{sources: make(configSources)}
 
 	// json configs
 
@@ -104,6 +387,12 @@ func loadConfig() *serviceConfig {
 			if err := dec.Decode(&cfg); err != nil {
 				log.Printf("error decoding %s: %s", env, err.Error())
 				valid = false
+				continue
+			}
+
+			var raw map[string]any
+			if err := json.Unmarshal([]byte(val), &raw); err == nil {
+				cfg.sources.record("", raw, "env:"+env)
 			}
 		}
 	}
@@ -116,15 +405,25 @@ func loadConfig() *serviceConfig {
 	// optional convenience override to simplify terraform config
 	if host := os.Getenv(envPrefix + "_SOLR_HOST"); host != "" {
 		cfg.Solr.Host = host
+		cfg.sources["solr.host"] = "env:" + envPrefix + "_SOLR_HOST"
+	}
+
+	// sensitive values, which may override anything set above
+
+	if cfg.loadSecrets() == false {
+		log.Printf("exiting due to secret loading error(s) above")
+		os.Exit(1)
 	}
 
-	bytes, err := json.Marshal(cfg)
+	cfg.applyDefaultsWithSources()
+
+	bytes, err := json.Marshal(cfg.redacted())
 	if err != nil {
 		log.Printf("error encoding config json: %s", err.Error())
 		os.Exit(1)
 	}
 
-	log.Printf("[CONFIG] composite json:\n%s", string(bytes))
+	log.Printf("[CONFIG] composite json (secrets redacted):\n%s", string(bytes))
 
 	return &cfg
 }
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+const (
+	coverPlaceholderLineLength = 18
+	coverPlaceholderMaxLines   = 6
+)
+
+type coverResponse struct {
+	StatusCode    int      `json:"status_code"`
+	StatusMessage string   `json:"status_msg,omitempty"`
+	Details       []string `json:"details,omitempty"`
+}
+
+type coverImage struct {
+	contentType string
+	data        []byte
+	source      string // url the image came from; empty for a generated placeholder
+}
+
+// the outcome of resolving a record's cover image
+type coverLookup struct {
+	img       coverImage
+	resp      searchResponse
+	cacheable bool
+}
+
+type serviceCoverProxy struct {
+	client        *http.Client
+	cache         *lruCache
+	inflight      *coalesceGroup
+	maxImageBytes int
+}
+
+func (p *serviceContext) initCoverProxy() {
+	cfg := p.config.Solr.CoverImages.Proxy
+
+	ttl := integerWithMinimum(cfg.TTL, 1)
+
+	p.coverProxy = &serviceCoverProxy{
+		client:        httpClientWithTimeouts(cfg.ConnTimeout, cfg.ReadTimeout),
+		cache:         newLRUCache(cfg.MaxEntries, cfg.MaxBytes, time.Duration(ttl)*time.Second),
+		inflight:      newCoalesceGroup(),
+		maxImageBytes: cfg.MaxImageBytes,
+	}
+
+	log.Printf("[SERVICE] cover proxy timeouts  = [conn: %ss, read: %ss]", cfg.ConnTimeout, cfg.ReadTimeout)
+	log.Printf("[SERVICE] cover proxy cache     = [%d entries, %d bytes, %ds ttl]", cfg.MaxEntries, cfg.MaxBytes, ttl)
+	log.Printf("[SERVICE] cover proxy max image = [%d bytes]", cfg.MaxImageBytes)
+	log.Printf("[SERVICE] cover url signing     = [%v]", p.config.Solr.CoverImages.SigningKey != "")
+	log.Printf("[SERVICE] cover proxy url       = [%s]", cfg.PublicURL)
+}
+
+func (p *serviceContext) coverProxyURL(id string) (string, error) {
+	// a signed link to our own cover endpoint, which browsers can load without a bearer token
+
+	cfg := p.config.Solr.CoverImages
+
+	link := strings.TrimSuffix(cfg.Proxy.PublicURL, "/") + "/api/cover/" + neturl.PathEscape(id)
+
+	ttl := time.Duration(integerWithMinimum(cfg.SignatureTTL, 1)) * time.Second
+
+	return coversign.Sign(link, []byte(cfg.SigningKey), coversign.Expiry(time.Now(), ttl))
+}
+
+func (p *serviceContext) validateCoverProxyConfig() bool {
+	// returns whether the published cover proxy url is usable
+
+	cfg := p.config.Solr.CoverImages
+
+	if cfg.Proxy.PublicURL == "" {
+		return true
+	}
+
+	valid := true
+
+	// signatures cover the path as this service sees it, so there can be no path prefix
+	u, err := neturl.Parse(cfg.Proxy.PublicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		log.Printf("[VALIDATE] cover proxy public url must be an http(s) origin, such as https://shelf-browse.example.edu")
+		valid = false
+	}
+
+	// browsers cannot send a bearer token when loading an image
+	if cfg.SigningKey == "" {
+		log.Printf("[VALIDATE] cover proxy public url requires a cover signing key")
+		valid = false
+	}
+
+	return valid
+}
+
+func (p *serviceContext) coverAuthHandler(c *gin.Context) {
+	// a signed url stands in for a bearer token
+
+	key := p.config.Solr.CoverImages.SigningKey
+
+	if key == "" || c.Query(coversign.SignatureParam) == "" {
+		p.authenticateHandler(c)
+		return
+	}
+
+	sig := c.Query(coversign.SignatureParam)
+
+	if err := coversign.VerifyRequest(c.Request, []byte(key)); err != nil {
+		p.auditAuth(c, authEvent{credential: authCredentialSignedURL, reason: authURLFailureReason(err), secret: sig, err: err})
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	p.auditAuth(c, authEvent{credential: authCredentialSignedURL, reason: authSuccess, secret: sig})
+}
+
+func (s *searchContext) lookupRecord(id string) (*solrDocument, searchResponse) {
+	// any record, whether or not it is on the shelf
+
+	if resp := s.performItemQuery(fmt.Sprintf("id:%s", solrQuoted(id))); resp.err != nil {
+		return nil, resp
+	}
+
+	doc := s.solrRes.Response.Docs[0]
+
+	return &doc, searchResponse{status: http.StatusOK}
+}
+
+// fetchCoverImage also reports whether a failure may be temporary (timeouts, server errors)
+func (s *searchContext) fetchCoverImage(url string) (coverImage, bool, error) {
+	proxy := s.svc.coverProxy
+
+	req, reqErr := http.NewRequest("GET", url, nil)
+	if reqErr != nil {
+		return coverImage{}, false, fmt.Errorf("failed to create cover request: %s", reqErr.Error())
+	}
+
+	req.Header.Set(requestIDHeader, s.client.reqID)
+
+	start := time.Now()
+	res, resErr := proxy.client.Do(req)
+	elapsedMS := int64(time.Since(start) / time.Millisecond)
+
+	if resErr != nil {
+		s.log("COVER: Failed response from %s %s. Elapsed Time: %d (ms)", req.Method, redactedURL(url), elapsedMS)
+		// the error repeats the (possibly signed) url, which is logged above in redacted form
+		var urlErr *neturl.Error
+		if errors.As(resErr, &urlErr) == true {
+			resErr = urlErr.Err
+		}
+		return coverImage{}, true, fmt.Errorf("cover request failed: %s", resErr.Error())
+	}
+
+	defer res.Body.Close()
+
+	s.log("COVER: Response %d from %s %s. Elapsed Time: %d (ms)", res.StatusCode, req.Method, redactedURL(url), elapsedMS)
+
+	if res.StatusCode != http.StatusOK {
+		return coverImage{}, res.StatusCode >= http.StatusInternalServerError, fmt.Errorf("cover request returned status %d", res.StatusCode)
+	}
+
+	contentType := res.Header.Get("Content-Type")
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || strings.HasPrefix(mediaType, "image/") == false {
+		return coverImage{}, false, fmt.Errorf("cover request returned non-image content type [%s]", contentType)
+	}
+
+	// read one byte more than allowed, to detect oversized images
+	data, readErr := io.ReadAll(io.LimitReader(res.Body, int64(proxy.maxImageBytes)+1))
+	if readErr != nil {
+		return coverImage{}, true, fmt.Errorf("failed to read cover image: %s", readErr.Error())
+	}
+
+	if len(data) > proxy.maxImageBytes {
+		return coverImage{}, false, fmt.Errorf("cover image exceeds %d bytes", proxy.maxImageBytes)
+	}
+
+	if len(data) == 0 {
+		return coverImage{}, false, fmt.Errorf("cover image is empty")
+	}
+
+	return coverImage{contentType: contentType, data: data, source: url}, false, nil
+}
+
+func xmlEscaped(str string) string {
+	var buf bytes.Buffer
+
+	xml.EscapeText(&buf, []byte(str))
+
+	return buf.String()
+}
+
+func wrapWords(str string, width, maxLines int) []string {
+	// splits str into lines of about width characters, truncating with an ellipsis
+
+	var lines []string
+
+	line := ""
+
+	for _, word := range strings.Fields(str) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+
+		line += word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] += "…"
+	}
+
+	return lines
+}
+
+func coverPlaceholder(title, callNumber string) coverImage {
+	// a plain book cover showing the title and call number
+
+	var svg strings.Builder
+
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="200" height="300" viewBox="0 0 200 300">`)
+	svg.WriteString(`<rect width="200" height="300" fill="#f1f1f1" stroke="#ccc" stroke-width="2"/>`)
+	svg.WriteString(`<g font-family="sans-serif" fill="#232d4b" text-anchor="middle">`)
+
+	for i, line := range wrapWords(title, coverPlaceholderLineLength, coverPlaceholderMaxLines) {
+		svg.WriteString(fmt.Sprintf(`<text x="100" y="%d" font-size="16" font-weight="bold">%s</text>`, 60+22*i, xmlEscaped(line)))
+	}
+
+	if callNumber != "" {
+		svg.WriteString(fmt.Sprintf(`<text x="100" y="270" font-size="13">%s</text>`, xmlEscaped(callNumber)))
+	}
+
+	svg.WriteString(`</g></svg>`)
+
+	return coverImage{contentType: "image/svg+xml", data: []byte(svg.String())}
+}
+
+func (s *searchContext) resolveCoverImage(id string) coverLookup {
+	// the first cover image any configured provider has for the record, or a placeholder
+
+	doc, resp := s.lookupRecord(id)
+	if resp.err != nil {
+		return coverLookup{resp: resp}
+	}
+
+	// a placeholder is only worth caching if no provider might have a cover next time
+	cacheable := true
+
+	for _, url := range s.getCoverImageURLs(doc) {
+		img, transient, err := s.fetchCoverImage(url)
+		if err == nil {
+			return coverLookup{img: img, resp: searchResponse{status: http.StatusOK}, cacheable: true}
+		}
+
+		s.warn("cover image unavailable: %s", err.Error())
+
+		if transient == true {
+			cacheable = false
+		}
+	}
+
+	s.log("no cover image found; using placeholder")
+
+	item := shelfBrowseItem{doc: doc}
+
+	title := s.itemField(item, fieldTitle)
+	if title == "" {
+		title = doc.getFirstString(s.svc.config.Solr.CoverImages.TitleField)
+	}
+
+	return coverLookup{img: coverPlaceholder(title, s.itemField(item, fieldCallNumber)), resp: searchResponse{status: http.StatusOK}, cacheable: cacheable}
+}
+
+func (s *searchContext) handleCoverRequest() coverLookup {
+	id := s.client.ginCtx.Param("id")
+
+	proxy := s.svc.coverProxy
+
+	if cached, ok := proxy.cache.get(id, 0); ok == true {
+		s.log("cover image for [%s] found in cache", id)
+		return coverLookup{img: cached.(coverImage), resp: searchResponse{status: http.StatusOK}}
+	}
+
+	d := s.detached()
+
+	val, shared, err := proxy.inflight.do(s.context(), id, func() (any, error) {
+		res := d.resolveCoverImage(id)
+
+		// placeholders are cached too, so that records without covers do not keep hitting the providers
+		if res.cacheable == true {
+			proxy.cache.put(id, res.img, len(res.img.data), 0)
+		}
+
+		return res, nil
+	})
+
+	if err != nil {
+		return coverLookup{resp: searchResponse{status: coalesceErrorStatus(err), err: err}}
+	}
+
+	if shared == true {
+		s.log("joined in-flight cover lookup for [%s]", id)
+	}
+
+	return val.(coverLookup)
+}
+
+func (p *serviceContext) coverHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	// images are served from our origin, so make sure they can never act as documents
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	if p.rejectInvalidRequest(&cl, "getCoverImage", func(status int, errs []string) any {
+		return coverResponse{StatusCode: status, StatusMessage: "invalid parameters", Details: errs}
+	}) == true {
+		return
+	}
+
+	res := s.handleCoverRequest()
+
+	cl.logResponse(res.resp)
+
+	if res.resp.err != nil {
+		c.JSON(res.resp.status, coverResponse{StatusCode: res.resp.status, StatusMessage: res.resp.err.Error()})
+		return
+	}
+
+	if res.img.source == "" {
+		c.Header("X-Cover-Placeholder", "true")
+	}
+
+	c.Header("Cache-Control", p.config.Caching.CacheControl)
+	c.Data(res.resp.status, res.img.contentType, res.img.data)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+// a stand-in cover service, whose behavior depends on the record id in the url
+type testCoverService struct {
+	*httptest.Server
+	hits atomic.Int64
+}
+
+func newTestCoverService() *testCoverService {
+	cs := &testCoverService{}
+
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.hits.Add(1)
+
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPNG)
+
+		case "html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>not an image</html>"))
+
+		case "oversize":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(bytes.Repeat([]byte("x"), 4096))
+
+		case "slow":
+			// outlasts the proxy's read timeout
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return cs
+}
+
+func newTestSolrForCovers() *httptest.Server {
+	// every id exists, titled after itself
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Q string `json:"q"`
+			} `json:"params"`
+		}
+
+		json.NewDecoder(r.Body).Decode(&req)
+
+		id := strings.Trim(strings.TrimPrefix(req.Params.Q, "id:"), `"`)
+
+		doc := map[string]any{"id": id, "title_a": []any{"Title of " + id}, "call_number_a": []any{"QA 76 .T47"}}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"responseHeader": map[string]any{"status": 0},
+			"response":       map[string]any{"numFound": 1, "docs": []any{doc}},
+		})
+	}))
+}
+
+type coverProxyTest struct {
+	svc    *serviceContext
+	router *gin.Engine
+	token  string
+	covers *testCoverService
+}
+
+func newCoverProxyTest(t *testing.T) *coverProxyTest {
+	t.Helper()
+
+	covers := newTestCoverService()
+	t.Cleanup(covers.Close)
+
+	solr := newTestSolrForCovers()
+	t.Cleanup(solr.Close)
+
+	cfg := testConfig()
+	cfg.Solr.Host = solr.URL
+	cfg.Solr.CoverImages.URLPrefix = covers.URL + "/"
+	cfg.Solr.CoverImages.Proxy = serviceConfigCoverProxy{ReadTimeout: "1", MaxImageBytes: 1024}
+
+	svc := newTestService(t, cfg)
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &coverProxyTest{svc: svc, router: svc.newRouter(), token: token, covers: covers}
+}
+
+func (ct *coverProxyTest) get(id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/cover/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+ct.token)
+
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, req)
+
+	return w
+}
+
+func (ct *coverProxyTest) cached(id string) bool {
+	_, ok := ct.svc.coverProxy.cache.get(id, 0)
+	return ok
+}
+
+func assertPlaceholder(t *testing.T, w *httptest.ResponseRecorder, id string) {
+	t.Helper()
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" || w.Header().Get("X-Cover-Placeholder") != "true" {
+		t.Fatalf("got %d %s (placeholder: %s), want an svg placeholder", w.Code, w.Header().Get("Content-Type"), w.Header().Get("X-Cover-Placeholder"))
+	}
+
+	if strings.Contains(w.Body.String(), "Title of "+id) == false || strings.Contains(w.Body.String(), "QA 76 .T47") == false {
+		t.Errorf("placeholder does not show the title and call number:\n%s", w.Body.String())
+	}
+}
+
+func TestCoverProxyPassesImagesThrough(t *testing.T) {
+	ct := newCoverProxyTest(t)
+
+	w := ct.get("image")
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || bytes.Equal(w.Body.Bytes(), testPNG) == false {
+		t.Fatalf("got %d %s [%q], want the provider's image", w.Code, w.Header().Get("Content-Type"), w.Body.Bytes())
+	}
+
+	if w.Header().Get("X-Cover-Placeholder") != "" {
+		t.Error("a provider image is flagged as a placeholder")
+	}
+
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Security-Policy") == "" {
+		t.Error("image is served without nosniff and a content security policy")
+	}
+
+	if ct.cached("image") == false {
+		t.Error("image was not cached")
+	}
+}
+
+func TestCoverProxyRejectsNonImages(t *testing.T) {
+	ct := newCoverProxyTest(t)
+
+	assertPlaceholder(t, ct.get("html"), "html")
+}
+
+func TestCoverProxyRejectsOversizeImages(t *testing.T) {
+	ct := newCoverProxyTest(t)
+
+	assertPlaceholder(t, ct.get("oversize"), "oversize")
+}
+
+func TestCoverProxyTimeoutIsNotCached(t *testing.T) {
+	ct := newCoverProxyTest(t)
+
+	assertPlaceholder(t, ct.get("slow"), "slow")
+
+	// the provider may have a cover next time, so the placeholder must not stick
+	if ct.cached("slow") == true {
+		t.Error("placeholder was cached after a provider timeout")
+	}
+}
+
+func TestCoverProxyCachesPlaceholderForMissingCover(t *testing.T) {
+	ct := newCoverProxyTest(t)
+
+	assertPlaceholder(t, ct.get("missing"), "missing")
+
+	if ct.cached("missing") == false {
+		t.Fatal("placeholder was not cached after a 404")
+	}
+
+	hits := ct.covers.hits.Load()
+
+	assertPlaceholder(t, ct.get("missing"), "missing")
+
+	if ct.covers.hits.Load() != hits {
+		t.Error("cover service was asked again for a cached placeholder")
+	}
+}
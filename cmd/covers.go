@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// cover image provider types
+const (
+	coverProviderVirgo       = "virgo"       // our own cover image service
+	coverProviderOpenLibrary = "openlibrary" // covers.openlibrary.org
+	coverProviderGoogleBooks = "googlebooks" // books.google.com front covers
+)
+
+var coverProviderTypes = []string{coverProviderVirgo, coverProviderOpenLibrary, coverProviderGoogleBooks}
+
+// output item field listing any fallback cover image urls, space-separated, in order of preference
+const fieldCoverImageFallbacks = "cover_image_fallback_urls"
+
+// builds a cover image url for a record, or returns an empty string if it has nothing to go on
+type coverProvider interface {
+	coverURL(cfg serviceConfigCoverImages, doc *solrDocument) (string, error)
+}
+
+type namedCoverProvider struct {
+	name string
+	coverProvider
+}
+
+type openLibraryCoverProvider struct {
+	urlPrefix string
+	size      string
+}
+
+type googleBooksCoverProvider struct {
+	urlPrefix string
+}
+
+// the providers to try, in order, for records in the given pools/formats
+type coverChain struct {
+	pools     []string
+	formats   []string
+	providers []namedCoverProvider
+}
+
+func (o *openLibraryCoverProvider) coverURL(cfg serviceConfigCoverImages, doc *solrDocument) (string, error) {
+	// https://openlibrary.org/dev/docs/api/covers
+
+	for _, kind := range []string{normalizeISBN, normalizeOCLC, normalizeLCCN} {
+		if id := firstElementOf(cfg.identifiers(doc, kind)); id != "" {
+			// without default=false, a blank image is returned instead of a 404
+			return fmt.Sprintf("%s/%s/%s-%s.jpg?default=false", o.urlPrefix, kind, url.PathEscape(id), o.size), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (g *googleBooksCoverProvider) coverURL(cfg serviceConfigCoverImages, doc *solrDocument) (string, error) {
+	for _, kind := range []string{normalizeISBN, normalizeOCLC, normalizeLCCN} {
+		if id := firstElementOf(cfg.identifiers(doc, kind)); id != "" {
+			qp := url.Values{}
+			qp.Set("vid", strings.ToUpper(kind)+id)
+			qp.Set("printsec", "frontcover")
+			qp.Set("img", "1")
+			qp.Set("zoom", "1")
+
+			return g.urlPrefix + "?" + qp.Encode(), nil
+		}
+	}
+
+	return "", nil
+}
+
+func newCoverProvider(cfg serviceConfigCoverProvider) coverProvider {
+	switch cfg.Type {
+	case coverProviderVirgo:
+		return &virgoCoverProvider{urlPrefix: cfg.URLPrefix}
+
+	case coverProviderOpenLibrary:
+		return &openLibraryCoverProvider{urlPrefix: strings.TrimSuffix(cfg.URLPrefix, "/"), size: cfg.Size}
+
+	case coverProviderGoogleBooks:
+		return &googleBooksCoverProvider{urlPrefix: cfg.URLPrefix}
+	}
+
+	return nil
+}
+
+func (p *serviceContext) initCovers() {
+	cfg := p.config.Solr.CoverImages
+
+	providers := make(map[string]coverProvider)
+
+	for _, provider := range cfg.Providers {
+		providers[provider.Name] = newCoverProvider(provider)
+		log.Printf("[SERVICE] cover provider %-12s = [%s %s]", provider.Name, provider.Type, provider.URLPrefix)
+	}
+
+	p.coverChains = nil
+
+	for _, chain := range cfg.Chains {
+		cc := coverChain{pools: chain.Pools, formats: chain.Formats}
+
+		for _, name := range chain.Providers {
+			cc.providers = append(cc.providers, namedCoverProvider{name: name, coverProvider: providers[name]})
+		}
+
+		p.coverChains = append(p.coverChains, cc)
+
+		log.Printf("[SERVICE] cover chain = [pools: %s; formats: %s] -> [%s]", strings.Join(chain.Pools, ","), strings.Join(chain.Formats, ","), strings.Join(chain.Providers, ","))
+	}
+
+	for _, docType := range cfg.DocTypes {
+		var params []string
+		for _, param := range docType.Params {
+			params = append(params, param.Name+"="+param.Value)
+		}
+
+		log.Printf("[SERVICE] cover doc type %-10s = [pools: %s; formats: %s] -> [%s]", docType.DocType, strings.Join(docType.Pools, ","), strings.Join(docType.Formats, ","), strings.Join(params, ","))
+	}
+}
+
+func (p *serviceContext) validateCoverConfig() bool {
+	// returns whether the cover provider configuration is usable
+
+	cfg := p.config.Solr.CoverImages
+
+	valid := true
+
+	names := make(map[string]bool)
+
+	for i, provider := range cfg.Providers {
+		if provider.Name == "" || names[provider.Name] == true {
+			log.Printf("[VALIDATE] cover provider %d must have a unique name", i)
+			valid = false
+		}
+
+		names[provider.Name] = true
+
+		if sliceContainsString(coverProviderTypes, provider.Type) == false {
+			log.Printf("[VALIDATE] cover provider [%s] type must be one of: %s", provider.Name, strings.Join(coverProviderTypes, ", "))
+			valid = false
+		}
+	}
+
+	for i, chain := range cfg.Chains {
+		if len(chain.Providers) == 0 {
+			log.Printf("[VALIDATE] cover chain %d has no providers", i)
+			valid = false
+		}
+
+		for _, name := range chain.Providers {
+			if names[name] == false {
+				log.Printf("[VALIDATE] cover chain %d refers to unknown provider [%s]", i, name)
+				valid = false
+			}
+		}
+	}
+
+	for i, docType := range cfg.DocTypes {
+		if docType.DocType == "" {
+			log.Printf("[VALIDATE] cover doc type rule %d has no doc_type", i)
+			valid = false
+		}
+
+		for _, param := range docType.Params {
+			if sliceContainsString(coverValues(), param.Value) == false {
+				log.Printf("[VALIDATE] cover doc type [%s] parameter [%s] value must be one of: %s", docType.DocType, param.Name, strings.Join(coverValues(), ", "))
+				valid = false
+			}
+		}
+	}
+
+	if p.validateCoverProxyConfig() == false {
+		valid = false
+	}
+
+	return valid
+}
+
+func matchesAny(want, have []string) bool {
+	// an empty list matches anything
+
+	if len(want) == 0 {
+		return true
+	}
+
+	for _, val := range have {
+		if sliceContainsString(want, val) == true {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *coverChain) matches(pools, formats []string) bool {
+	return matchesAny(c.pools, pools) && matchesAny(c.formats, formats)
+}
+
+func (s *searchContext) getCoverImageURLs(doc *solrDocument) []string {
+	// cover image urls from the first chain matching the record, in order of preference
+
+	cfg := s.svc.config.Solr.CoverImages
+
+	pools := doc.getStrings(cfg.PoolField)
+	formats := doc.getStrings(cfg.FormatField)
+
+	var urls []string
+
+	for _, chain := range s.svc.coverChains {
+		if chain.matches(pools, formats) == false {
+			continue
+		}
+
+		for _, provider := range chain.providers {
+			url, err := provider.coverURL(cfg, doc)
+			if err != nil {
+				s.warn("%s cover url failed: %s", provider.name, err.Error())
+				s.svc.metrics.coverURLFailures.WithLabelValues(provider.name).Inc()
+				continue
+			}
+
+			if url != "" && sliceContainsString(urls, url) == false {
+				urls = append(urls, url)
+			}
+		}
+
+		break
+	}
+
+	return urls
+}
+
+func (s *searchContext) getClientCoverImageURLs(doc *solrDocument) []string {
+	// cover image urls for clients: our own cover endpoint if it is published, which tries
+	// every provider itself, or else the providers' urls
+
+	if s.svc.config.Solr.CoverImages.Proxy.PublicURL == "" {
+		return s.getCoverImageURLs(doc)
+	}
+
+	url, err := s.svc.coverProxyURL(doc.getFirstString("id"))
+	if err != nil {
+		s.warn("cover proxy url failed: %s", err.Error())
+		return nil
+	}
+
+	return []string{url}
+}
+
+func (s *searchContext) getCoverImageURL(doc *solrDocument) string {
+	return firstElementOf(s.getClientCoverImageURLs(doc))
+}
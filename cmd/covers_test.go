@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testCoverConfig() *serviceConfig {
+	cfg := testConfig()
+
+	cfg.Fields = append(cfg.Fields, serviceConfigField{Name: fieldCoverImageURL, Field: "cover_x"})
+
+	covers := &cfg.Solr.CoverImages
+
+	covers.AuthorFields = []string{"author_a"}
+	covers.OCLCField = "oclc_a"
+	covers.LCCNField = "lccn_a"
+	covers.UPCField = "upc_a"
+	covers.ISSNField = "issn_a"
+	covers.FormatField = "format_f"
+	covers.MusicPool = "music"
+
+	covers.Providers = []serviceConfigCoverProvider{
+		{Name: "virgo", Type: coverProviderVirgo},
+		{Name: "ol", Type: coverProviderOpenLibrary, Size: "M"},
+		{Name: "gb", Type: coverProviderGoogleBooks},
+	}
+
+	covers.Chains = []serviceConfigCoverChain{
+		{Pools: []string{"music"}, Providers: []string{"virgo"}},
+		{Formats: []string{"Book", "eBook"}, Providers: []string{"ol", "gb", "virgo"}},
+		{Providers: []string{"virgo"}},
+	}
+
+	return cfg
+}
+
+func TestCoverImageURLs(t *testing.T) {
+	svc := newTestService(t, testCoverConfig())
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	tests := []struct {
+		name string
+		doc  solrDocument
+		want []string
+	}{
+		{
+			name: "book chain, in order of preference",
+			doc:  solrDocument{"id": "b1", "title_a": []any{"A Book"}, "format_f": []any{"Book"}, "isbn_a": []any{"0-306-40615-2 (pbk.)"}},
+			want: []string{
+				"https://covers.openlibrary.org/b/isbn/9780306406157-M.jpg?default=false",
+				"https://books.google.com/books/content?img=1&printsec=frontcover&vid=ISBN9780306406157&zoom=1",
+				"http://covers.example.edu/b1?doc_type=non_music&isbn=9780306406157&title=A+Book",
+			},
+		},
+		{
+			name: "book chain, by oclc number when there is no valid isbn",
+			doc:  solrDocument{"id": "b2", "title_a": []any{"Another Book"}, "format_f": []any{"Map", "eBook"}, "isbn_a": []any{"0-306-40615-3"}, "oclc_a": []any{"(OCoLC)ocm00012345"}},
+			want: []string{
+				"https://covers.openlibrary.org/b/oclc/12345-M.jpg?default=false",
+				"https://books.google.com/books/content?img=1&printsec=frontcover&vid=OCLC12345&zoom=1",
+				"http://covers.example.edu/b2?doc_type=non_music&oclc=12345&title=Another+Book",
+			},
+		},
+		{
+			name: "book chain, skipping providers with nothing to go on",
+			doc:  solrDocument{"id": "b3", "title_a": []any{"No Identifiers"}, "format_f": []any{"Book"}},
+			want: []string{
+				"http://covers.example.edu/b3?doc_type=non_music&title=No+Identifiers",
+			},
+		},
+		{
+			name: "music chain, by pool",
+			doc:  solrDocument{"id": "m1", "title_a": []any{"An Album"}, "author_a": []any{"Davis, Miles, 1926-1991, performer."}, "pool_f": []any{"music"}, "format_f": []any{"Book"}, "upc_a": []any{"0 36000 29145 2"}},
+			want: []string{
+				"http://covers.example.edu/m1?album_name=An+Album&artist_name=Davis%2C+Miles&doc_type=music&upc=036000291452",
+			},
+		},
+		{
+			name: "fallback chain",
+			doc:  solrDocument{"id": "v1", "title_a": []any{"A Video"}, "format_f": []any{"Video"}, "isbn_a": []any{"9780306406157"}},
+			want: []string{
+				"http://covers.example.edu/v1?doc_type=non_music&isbn=9780306406157&title=A+Video",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := s.getCoverImageURLs(&test.doc)
+
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got urls\n  %s\nwant\n  %s", test.name, strings.Join(got, "\n  "), strings.Join(test.want, "\n  "))
+			continue
+		}
+
+		// the first url is the cover image, and the rest its fallbacks
+		item := s.buildItemMap(&test.doc)
+
+		if item[fieldCoverImageURL] != test.want[0] {
+			t.Errorf("%s: got cover image url [%s], want [%s]", test.name, item[fieldCoverImageURL], test.want[0])
+		}
+
+		if fallbacks := strings.Join(test.want[1:], " "); item[fieldCoverImageFallbacks] != fallbacks {
+			t.Errorf("%s: got fallback urls [%s], want [%s]", test.name, item[fieldCoverImageFallbacks], fallbacks)
+		}
+	}
+}
+
+func TestCoverDocTypes(t *testing.T) {
+	cfg := testCoverConfig()
+
+	// doc types only matter to our own cover image service
+	cfg.Solr.CoverImages.Chains = []serviceConfigCoverChain{{Providers: []string{"virgo"}}}
+
+	// no catch-all rule, so some records have no doc type
+	cfg.Solr.CoverImages.DocTypes = []serviceConfigCoverDocType{
+		{DocType: "music", Pools: []string{"music"}, Params: []serviceConfigCoverParam{{Name: "artist_name", Value: coverValueAuthor}, {Name: "album_name", Value: coverValueTitle}}},
+		{DocType: "serial", Formats: []string{"Journal/Magazine"}, Params: []serviceConfigCoverParam{{Value: coverValueTitle}, {Value: normalizeISSN}}},
+		{DocType: "non_music", Formats: []string{"Book"}, Params: []serviceConfigCoverParam{{Name: "book_title", Value: coverValueTitle}, {Value: normalizeISBN}}},
+	}
+
+	svc := newTestService(t, cfg)
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	tests := []struct {
+		name string
+		doc  solrDocument
+		want string
+	}{
+		{
+			name: "issns in standard form, without invalid or duplicate values",
+			doc:  solrDocument{"id": "j1", "title_a": []any{"A Journal"}, "format_f": []any{"Journal/Magazine"}, "issn_a": []any{"0317847-1", "ISSN 0317-8472", "03178471 (print)", "2049-3630"}},
+			want: "http://covers.example.edu/j1?doc_type=serial&issn=0317-8471%2C2049-3630&title=A+Journal",
+		},
+		{
+			name: "parameter names differing from their values",
+			doc:  solrDocument{"id": "b1", "title_a": []any{"A Book"}, "format_f": []any{"Book"}, "isbn_a": []any{"9780306406157"}, "issn_a": []any{"2049-3630"}},
+			want: "http://covers.example.edu/b1?book_title=A+Book&doc_type=non_music&isbn=9780306406157",
+		},
+		{
+			name: "pool rules before format rules",
+			doc:  solrDocument{"id": "m1", "title_a": []any{"An Album"}, "author_a": []any{"Davis, Miles"}, "pool_f": []any{"music"}, "format_f": []any{"Book"}},
+			want: "http://covers.example.edu/m1?album_name=An+Album&artist_name=Davis%2C+Miles&doc_type=music",
+		},
+		{
+			name: "unknown doc type",
+			doc:  solrDocument{"id": "x1", "title_a": []any{"A Map"}, "format_f": []any{"Map"}, "isbn_a": []any{"9780306406157"}},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		got := firstElementOf(s.getCoverImageURLs(&test.doc))
+
+		if got != test.want {
+			t.Errorf("%s: got url [%s], want [%s]", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supported browse response formats
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatJSONLD = "jsonld"
+	formatAtom   = "atom"
+)
+
+var browseFormats = []string{formatJSON, formatCSV, formatJSONLD, formatAtom}
+
+var browseFormatMimeTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatCSV:    "text/csv",
+	formatJSONLD: "application/ld+json",
+	formatAtom:   "application/atom+xml",
+}
+
+// output field names with a well-known meaning in the alternative formats
+const (
+	fieldID            = "id"
+	fieldTitle         = "title"
+	fieldAuthor        = "author"
+	fieldCallNumber    = "call_number"
+	fieldCoverImageURL = "cover_image_url"
+)
+
+func negotiateBrowseFormat(c *gin.Context) string {
+	// an explicit format parameter wins over the Accept header
+
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+
+	var offered []string
+	for _, format := range browseFormats {
+		offered = append(offered, browseFormatMimeTypes[format])
+	}
+
+	mimeType := c.NegotiateFormat(offered...)
+
+	for format, mt := range browseFormatMimeTypes {
+		if mt == mimeType {
+			return format
+		}
+	}
+
+	return ""
+}
+
+func (p *serviceContext) recordURL(id string) string {
+	if id == "" || p.config.Formats.RecordURLPrefix == "" {
+		return ""
+	}
+
+	return p.config.Formats.RecordURLPrefix + id
+}
+
+func (p *serviceContext) browseCSV(res shelfBrowseResponse) ([]byte, error) {
+	// one column per configured output field, in configured order
+
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+
+	var header []string
+	for _, field := range p.config.Fields {
+		header = append(header, field.Name)
+	}
+
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, item := range res.Items {
+		var row []string
+		for _, field := range p.config.Fields {
+			row = append(row, item[field.Name])
+		}
+
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+type jsonLDThing struct {
+	Type        string `json:"@type"`
+	ID          string `json:"@id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Identifier  string `json:"identifier,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Image       string `json:"image,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type jsonLDListItem struct {
+	Type     string      `json:"@type"`
+	Position int         `json:"position"`
+	Item     jsonLDThing `json:"item"`
+}
+
+type jsonLDItemList struct {
+	Context         string           `json:"@context"`
+	Type            string           `json:"@type"`
+	Name            string           `json:"name,omitempty"`
+	ItemListOrder   string           `json:"itemListOrder"`
+	NumberOfItems   int              `json:"numberOfItems"`
+	ItemListElement []jsonLDListItem `json:"itemListElement"`
+}
+
+func (p *serviceContext) browseJSONLD(id string, res shelfBrowseResponse) ([]byte, error) {
+	// schema.org ItemList, in shelf order
+
+	list := jsonLDItemList{
+		Context:         "https://schema.org",
+		Type:            "ItemList",
+		Name:            fmt.Sprintf("Items on the shelf near %s", id),
+		ItemListOrder:   "https://schema.org/ItemListOrderAscending",
+		NumberOfItems:   len(res.Items),
+		ItemListElement: []jsonLDListItem{},
+	}
+
+	for i, item := range res.Items {
+		url := p.recordURL(item[fieldID])
+
+		thing := jsonLDThing{
+			Type:        "CreativeWork",
+			ID:          url,
+			Name:        item[fieldTitle],
+			Identifier:  item[fieldID],
+			Author:      item[fieldAuthor],
+			Image:       item[fieldCoverImageURL],
+			URL:         url,
+			Description: item[fieldCallNumber],
+		}
+
+		list.ItemListElement = append(list.ItemListElement, jsonLDListItem{Type: "ListItem", Position: i + 1, Item: thing})
+	}
+
+	return json.MarshalIndent(list, "", "  ")
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Summary string      `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (p *serviceContext) browseAtom(id, selfURL string, updated time.Time, res shelfBrowseResponse) ([]byte, error) {
+	// one entry per item, in shelf order.  entries carry the feed's time, which only moves
+	// when the index changes, so that polling clients do not see every entry as updated.
+
+	stamp := updated.UTC().Format(time.RFC3339)
+
+	feed := atomFeed{
+		ID:      "urn:virgo4:shelf-browse:" + id,
+		Title:   fmt.Sprintf("Items on the shelf near %s", id),
+		Updated: stamp,
+		Author:  atomPerson{Name: "Virgo"},
+		Links:   []atomLink{{Href: selfURL, Rel: "self", Type: browseFormatMimeTypes[formatAtom]}},
+	}
+
+	for _, item := range res.Items {
+		entry := atomEntry{
+			ID:      "urn:virgo4:record:" + item[fieldID],
+			Title:   item[fieldTitle],
+			Updated: stamp,
+			Summary: item[fieldCallNumber],
+		}
+
+		if author := item[fieldAuthor]; author != "" {
+			entry.Author = &atomPerson{Name: author}
+		}
+
+		if url := p.recordURL(item[fieldID]); url != "" {
+			entry.Links = append(entry.Links, atomLink{Href: url, Rel: "alternate", Type: "text/html"})
+		}
+
+		if cover := item[fieldCoverImageURL]; cover != "" {
+			entry.Links = append(entry.Links, atomLink{Href: cover, Rel: "enclosure"})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+func (p *serviceContext) encodeBrowseResponse(c *gin.Context, format string, resp searchResponse) ([]byte, error) {
+	// errors, and anything not requesting an alternative format, are encoded as json
+
+	res, ok := resp.data.(shelfBrowseResponse)
+
+	if format == formatJSON || resp.status != http.StatusOK || ok == false {
+		return json.Marshal(resp.data)
+	}
+
+	id := c.Param("id")
+
+	switch format {
+	case formatCSV:
+		return p.browseCSV(res)
+
+	case formatJSONLD:
+		return p.browseJSONLD(id, res)
+
+	case formatAtom:
+		selfURL := fmt.Sprintf("%s%s", p.config.Formats.FeedURLPrefix, c.Request.URL.RequestURI())
+
+		// without a known index version the response is not cacheable anyway
+		updated := res.updated
+		if updated.IsZero() == true {
+			updated = time.Now()
+		}
+
+		return p.browseAtom(id, selfURL, updated, res)
+	}
+
+	return nil, fmt.Errorf("unsupported format [%s]", format)
+}
+
+func (p *serviceContext) writeBrowseResponse(c *gin.Context, format string, resp searchResponse, body []byte) {
+	// body is the output of encodeBrowseResponse for the same format and response
+
+	if format == formatJSON || resp.status != http.StatusOK {
+		c.Data(resp.status, browseFormatMimeTypes[formatJSON]+"; charset=utf-8", body)
+		return
+	}
+
+	if format == formatCSV {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="shelf-%s.csv"`, c.Param("id")))
+	}
+
+	c.Data(resp.status, browseFormatMimeTypes[format]+"; charset=utf-8", body)
+}
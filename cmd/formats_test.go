@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with current output")
+
+func formatsTestService() *serviceContext {
+	cfg := testConfig()
+
+	cfg.Fields = []serviceConfigField{
+		{Name: fieldID, Field: "id"},
+		{Name: fieldTitle, Field: "title_a"},
+		{Name: fieldAuthor, Field: "author_a"},
+		{Name: fieldCallNumber, Field: "call_number_a"},
+		{Name: fieldCoverImageURL, Field: "cover_x"},
+	}
+
+	return &serviceContext{config: cfg}
+}
+
+func formatsTestResponse() shelfBrowseResponse {
+	// includes values needing quoting or escaping in each format, and an item with missing fields
+
+	return shelfBrowseResponse{
+		StatusCode: 200,
+		Items: []map[string]string{
+			{
+				fieldID:            "u1001",
+				fieldTitle:         "Rivers, lakes & \"wetlands\"",
+				fieldAuthor:        "Smith, Jane",
+				fieldCallNumber:    "QH 98 .S65 2001",
+				fieldCoverImageURL: "https://covers.example.edu/u1001.jpg",
+			},
+			{
+				fieldID:         "u1002",
+				fieldTitle:      "The <estuary> book",
+				fieldCallNumber: "QH 98 .T44 1999",
+			},
+			{
+				fieldID:            "u1003",
+				fieldTitle:         "Ponds\nand streams",
+				fieldAuthor:        "Doe, John",
+				fieldCallNumber:    "QH 98.5 .D64",
+				fieldCoverImageURL: "https://covers.example.edu/u1003.jpg?size=M&x=1",
+			},
+		},
+	}
+}
+
+func compareGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *updateGolden == true {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("writing %s: %s", path, err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %s", path, err)
+	}
+
+	if bytes.Equal(got, want) == false {
+		t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestBrowseCSV(t *testing.T) {
+	out, err := formatsTestService().browseCSV(formatsTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGolden(t, "browse.csv", out)
+}
+
+func TestBrowseJSONLD(t *testing.T) {
+	out, err := formatsTestService().browseJSONLD("u1002", formatsTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGolden(t, "browse.jsonld", out)
+}
+
+func TestBrowseAtom(t *testing.T) {
+	updated := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+	out, err := formatsTestService().browseAtom("u1002", "https://shelf.example.edu/api/browse/u1002?format=atom", updated, formatsTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGolden(t, "browse.atom", out)
+}
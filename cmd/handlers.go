@@ -3,7 +3,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
@@ -19,12 +18,146 @@ func (p *serviceContext) browseHandler(c *gin.Context) {
 	s.init(p, &cl)
 
 	cl.logRequest()
+
+	if p.rejectInvalidRequest(&cl, "getShelfBrowse", func(status int, errs []string) any {
+		return shelfBrowseResponse{StatusCode: status, StatusMessage: "invalid parameters", Details: errs}
+	}) == true {
+		return
+	}
+
+	c.Header("Vary", "Accept")
+
+	format := negotiateBrowseFormat(c)
+	if format == "" {
+		resp := searchResponse{status: http.StatusNotAcceptable, err: fmt.Errorf("no acceptable format for: %s", c.GetHeader("Accept"))}
+		resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: resp.err.Error()}
+		cl.logResponse(resp)
+		c.JSON(resp.status, resp.data)
+		return
+	}
+
 	resp := s.handleBrowseRequest()
+
+	// a client with a current copy does not need the response encoded at all
+	if s.handleCacheValidators(format, resp) == true {
+		resp.status = http.StatusNotModified
+		cl.logResponse(resp)
+		c.Status(resp.status)
+		return
+	}
+
+	body, err := p.encodeBrowseResponse(c, format, resp)
+	if err != nil {
+		resp = searchResponse{status: http.StatusInternalServerError, err: err}
+		resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: err.Error()}
+		cl.logResponse(resp)
+		c.JSON(resp.status, resp.data)
+		return
+	}
+
+	cl.logResponse(resp)
+
+	p.writeBrowseResponse(c, format, resp, body)
+}
+
+func (p *serviceContext) batchBrowseHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	if p.rejectInvalidRequest(&cl, "postShelfBrowseBatch", func(status int, errs []string) any {
+		return shelfBrowseBatchResponse{StatusCode: status, StatusMessage: "invalid parameters", Details: errs}
+	}) == true {
+		return
+	}
+
+	resp := s.handleBatchBrowseRequest()
+	cl.logResponse(resp)
+
+	c.JSON(resp.status, resp.data)
+}
+
+func (p *serviceContext) virtualShelfHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	if p.rejectInvalidRequest(&cl, "postVirtualShelf", func(status int, errs []string) any {
+		return virtualShelfResponse{StatusCode: status, StatusMessage: "invalid parameters", Details: errs}
+	}) == true {
+		return
+	}
+
+	resp := s.handleVirtualShelfRequest()
 	cl.logResponse(resp)
 
 	c.JSON(resp.status, resp.data)
 }
 
+func (p *serviceContext) classificationHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	if p.rejectInvalidRequest(&cl, "getClassification", func(status int, errs []string) any {
+		return classificationResponse{StatusCode: status, StatusMessage: "invalid parameters", Details: errs}
+	}) == true {
+		return
+	}
+
+	resp := s.handleClassificationRequest()
+	cl.logResponse(resp)
+
+	c.JSON(resp.status, resp.data)
+}
+
+// builds the body of a 400 response from the reasons a request is invalid
+type invalidRequestBody func(status int, errs []string) any
+
+func (p *serviceContext) invalidRequest(cl *clientContext, operationID string, body invalidRequestBody) *searchResponse {
+	// validates a request against the api description, returning a 400 response if it is invalid
+
+	errs := p.openAPI.validateRequest(cl.ginCtx, operationID)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	resp := searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid parameters: %s", strings.Join(errs, "; "))}
+	resp.data = body(resp.status, errs)
+
+	return &resp
+}
+
+func (p *serviceContext) rejectInvalidRequest(cl *clientContext, operationID string, body invalidRequestBody) bool {
+	// answers an invalid request with a json 400; returns whether it did
+
+	resp := p.invalidRequest(cl, operationID, body)
+	if resp == nil {
+		return false
+	}
+
+	cl.logResponse(*resp)
+	cl.ginCtx.JSON(resp.status, resp.data)
+
+	return true
+}
+
+func (p *serviceContext) openAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, p.openAPI)
+}
+
 func (p *serviceContext) ignoreHandler(c *gin.Context) {
 }
 
@@ -70,12 +203,30 @@ func (p *serviceContext) healthCheckHandler(c *gin.Context) {
 	c.JSON(hcStatus, hcMap)
 }
 
+func (p *serviceContext) adminConfigHandler(c *gin.Context) {
+	type configResp struct {
+		Config  serviceConfig     `json:"config"`
+		Sources map[string]string `json:"sources"`
+	}
+
+	c.JSON(http.StatusOK, configResp{Config: p.config.redacted(), Sources: p.config.sources})
+}
+
+func (p *serviceContext) adminCacheHandler(c *gin.Context) {
+	type cacheResp struct {
+		Terms lruCacheStats `json:"terms"`
+		Items lruCacheStats `json:"items"`
+	}
+
+	c.JSON(http.StatusOK, cacheResp{Terms: p.resultCache.terms.getStats(), Items: p.resultCache.items.getStats()})
+}
+
 func getBearerToken(authorization string) (string, error) {
 	components := strings.Split(strings.Join(strings.Fields(authorization), " "), " ")
 
 	// must have two components, the first of which is "Bearer", and the second a non-empty token
 	if len(components) != 2 || components[0] != "Bearer" || components[1] == "" {
-		return "", fmt.Errorf("invalid Authorization header: [%s]", authorization)
+		return "", errors.New("invalid Authorization header")
 	}
 
 	token := components[1]
@@ -90,7 +241,19 @@ func getBearerToken(authorization string) (string, error) {
 func (p *serviceContext) authenticateHandler(c *gin.Context) {
 	token, err := getBearerToken(c.GetHeader("Authorization"))
 	if err != nil {
-		log.Printf("Authentication failed: [%s]", err.Error())
+		p.auditAuth(c, authEvent{credential: authCredentialHeader, reason: authHeaderFailureReason(c.GetHeader("Authorization")), err: err})
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	p.authenticateToken(c, authCredentialHeader, token)
+}
+
+func (p *serviceContext) authenticateToken(c *gin.Context, credential string, token string) {
+	// the token itself must never be logged; the audit log only records its fingerprint
+
+	if token == "" {
+		p.auditAuth(c, authEvent{credential: credential, reason: authMissingToken})
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
@@ -98,10 +261,30 @@ func (p *serviceContext) authenticateHandler(c *gin.Context) {
 	claims, err := v4jwt.Validate(token, p.config.JWTKey)
 
 	if err != nil {
-		log.Printf("JWT signature for %s is invalid: %s", token, err.Error())
+		p.auditAuth(c, authEvent{credential: credential, reason: authTokenFailureReason(err), secret: token, err: err})
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
+	p.auditAuth(c, authEvent{credential: credential, reason: authSuccess, secret: token, claims: claims})
+
 	c.Set("claims", claims)
+	c.Set(authCredentialKey, credential)
+}
+
+func (p *serviceContext) requireAdminHandler(c *gin.Context) {
+	val, ok := c.Get("claims")
+	if ok == false {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	claims := val.(*v4jwt.V4Claims)
+
+	if claims.Role != v4jwt.Admin {
+		err := fmt.Errorf("role %s is not admin", claims.Role.String())
+		p.auditAuth(c, authEvent{credential: c.GetString(authCredentialKey), reason: authNotAdmin, claims: claims, err: err})
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"    // gin context key
+	requestErrorKey = "request_error" // gin context key
+)
+
+// log output formats
+const (
+	loggingFormatJSON = "json"
+	loggingFormatText = "text"
+)
+
+var loggingFormats = []string{loggingFormatJSON, loggingFormatText}
+
+// request ids we accept from callers; anything else is replaced with one of our own
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// the current log level, adjustable at runtime
+var logLevel = new(slog.LevelVar)
+
+func setupLogging(format string) {
+	// all logging, including the standard logger's, goes through slog
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	auditOpts := &slog.HandlerOptions{Level: slog.LevelInfo}
+
+	var handler slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	var auditHandler slog.Handler = slog.NewJSONHandler(os.Stderr, auditOpts)
+
+	if format == loggingFormatText {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+		auditHandler = slog.NewTextHandler(os.Stderr, auditOpts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	setupAuditLogging(auditHandler)
+}
+
+func parseLogLevel(str string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(str))); err != nil {
+		return level, fmt.Errorf("invalid log level [%s]; must be one of: debug, info, warn, error", str)
+	}
+
+	return level, nil
+}
+
+func (p *serviceContext) initLogging() {
+	// the configuration is only known once loaded, so switch format/level now
+
+	setupLogging(p.config.Logging.Format)
+
+	level, _ := parseLogLevel(p.config.Logging.Level)
+	logLevel.Set(level)
+
+	log.Printf("[SERVICE] logging.format       = [%s]", p.config.Logging.Format)
+	log.Printf("[SERVICE] logging.level        = [%s]", logLevel.Level())
+}
+
+func newRequestID() string {
+	// the package-level source is safe for concurrent use
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+func (p *serviceContext) requestHandler(c *gin.Context) {
+	// assigns each request an id (the caller's, if usable), and logs its outcome
+
+	reqID := c.GetHeader(requestIDHeader)
+	if requestIDRegex.MatchString(reqID) == false {
+		reqID = newRequestID()
+	}
+
+	c.Set(requestIDKey, reqID)
+	c.Header(requestIDHeader, reqID)
+
+	start := time.Now()
+
+	c.Next()
+
+	attrs := []any{
+		"request_id", reqID,
+		"method", c.Request.Method,
+		"route", c.FullPath(),
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"latency_ms", time.Since(start).Milliseconds(),
+		"client_ip", c.ClientIP(),
+	}
+
+	if val, ok := c.Get("claims"); ok == true {
+		attrs = append(attrs, "user_id", val.(*v4jwt.V4Claims).UserID)
+	}
+
+	level := slog.LevelInfo
+
+	// set by handlers, see logResponse
+	if val, ok := c.Get(requestErrorKey); ok == true {
+		attrs = append(attrs, "error", val.(error).Error())
+
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+	}
+
+	slog.Log(context.Background(), level, "request completed", attrs...)
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type logLevelResponse struct {
+	Level         string `json:"level,omitempty"`
+	StatusCode    int    `json:"status_code"`
+	StatusMessage string `json:"status_msg,omitempty"`
+}
+
+func (p *serviceContext) adminLogLevelHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	if c.Request.Method == http.MethodGet {
+		c.JSON(http.StatusOK, logLevelResponse{Level: logLevel.Level().String(), StatusCode: http.StatusOK})
+		return
+	}
+
+	var req logLevelRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, logLevelResponse{StatusCode: http.StatusBadRequest, StatusMessage: "invalid request body"})
+		return
+	}
+
+	level, err := parseLogLevel(req.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, logLevelResponse{StatusCode: http.StatusBadRequest, StatusMessage: err.Error()})
+		return
+	}
+
+	prev := logLevel.Level()
+	logLevel.Set(level)
+
+	// logged at warn, so that it is seen whatever the new level is
+	cl.logAt(slog.LevelWarn, "log level changed from %s to %s", prev, level)
+
+	c.JSON(http.StatusOK, logLevelResponse{Level: level.String(), StatusCode: http.StatusOK})
+}
+
+func (c *clientContext) logAt(level slog.Level, format string, args ...any) {
+	if slog.Default().Enabled(context.Background(), level) == false {
+		return
+	}
+
+	slog.Log(context.Background(), level, fmt.Sprintf(format, args...), c.logAttrs()...)
+}
+
+func (c *clientContext) logAttrs(attrs ...any) []any {
+	res := []any{"request_id", c.reqID}
+
+	if c.route != "" {
+		res = append(res, "route", c.route)
+	}
+
+	if c.claims != nil {
+		res = append(res, "user_id", c.claims.UserID)
+	}
+
+	return append(res, attrs...)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestEachRequestLoggedOnce(t *testing.T) {
+	solr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer solr.Close()
+
+	shelf := newTestShelf("a", "b", "c")
+	defer shelf.Close()
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, testConfig().JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := testConfig()
+	failing.Solr.Host = solr.URL
+
+	shelved := newTestService(t, shelf.config()).newRouter()
+	broken := newTestService(t, failing).newRouter()
+
+	// services set up logging as they start, so capture it from here on
+	var buf bytes.Buffer
+
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	defer slog.SetDefault(prev)
+
+	tests := []struct {
+		name   string
+		router http.Handler
+		path   string
+		status int
+		level  string
+		error  bool
+	}{
+		{name: "success", router: shelved, path: "/api/browse/b?range=1", status: http.StatusOK, level: "INFO"},
+		{name: "invalid", router: shelved, path: "/api/browse/b?range=0", status: http.StatusBadRequest, level: "INFO", error: true},
+		{name: "not found", router: shelved, path: "/api/browse/missing", status: http.StatusNotFound, level: "INFO", error: true},
+		{name: "failure", router: broken, path: "/api/browse/b", status: http.StatusInternalServerError, level: "ERROR", error: true},
+	}
+
+	for _, test := range tests {
+		buf.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		test.router.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+
+		var completed []map[string]any
+
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]any
+			if json.Unmarshal([]byte(line), &entry) != nil {
+				continue
+			}
+
+			if entry["msg"] == "[RESPONSE]" {
+				t.Errorf("%s: got a separate response entry %s", test.name, line)
+			}
+
+			if entry["msg"] == "request completed" {
+				completed = append(completed, entry)
+			}
+		}
+
+		if len(completed) != 1 {
+			t.Errorf("%s: got %d completion entries, want one", test.name, len(completed))
+			continue
+		}
+
+		entry := completed[0]
+
+		if entry["level"] != test.level || entry["status"] != float64(test.status) || entry["request_id"] != w.Header().Get(requestIDHeader) {
+			t.Errorf("%s: got completion entry %v, want a %s entry for status %d", test.name, entry, test.level, test.status)
+		}
+
+		if _, ok := entry["error"]; ok != test.error {
+			t.Errorf("%s: got completion entry %v, want an error: %v", test.name, entry, test.error)
+		}
+	}
+}
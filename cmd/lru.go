@@ -0,0 +1,138 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruCacheStats struct {
+	Entries       int   `json:"entries"`
+	Bytes         int   `json:"bytes"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Expirations   int64 `json:"expirations"`
+	Invalidations int64 `json:"invalidations"`
+	IndexVersion  int64 `json:"index_version"`
+}
+
+type lruCacheEntry struct {
+	key     string
+	value   any
+	size    int
+	expires time.Time
+}
+
+// a size- and count-bounded lru cache whose entries expire after a ttl,
+// and which is emptied whenever the solr index version changes
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	ttl        time.Duration
+	ll         *list.List
+	entries    map[string]*list.Element
+	stats      lruCacheStats
+}
+
+func newLRUCache(maxEntries, maxBytes int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		ll:         list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) checkVersion(version int64) {
+	// caller must hold the lock
+
+	if version == c.stats.IndexVersion {
+		return
+	}
+
+	if c.ll.Len() > 0 {
+		c.stats.Invalidations++
+	}
+
+	c.ll.Init()
+	c.entries = make(map[string]*list.Element)
+	c.stats.Entries = 0
+	c.stats.Bytes = 0
+	c.stats.IndexVersion = version
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	// caller must hold the lock
+
+	entry := el.Value.(*lruCacheEntry)
+
+	c.ll.Remove(el)
+	delete(c.entries, entry.key)
+
+	c.stats.Entries--
+	c.stats.Bytes -= entry.size
+}
+
+func (c *lruCache) get(key string, version int64) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion(version)
+
+	el, ok := c.entries[key]
+	if ok == false {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*lruCacheEntry)
+
+	if time.Now().After(entry.expires) {
+		c.removeElement(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+
+	return entry.value, true
+}
+
+func (c *lruCache) put(key string, value any, size int, version int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion(version)
+
+	// never cache anything that could not fit on its own
+	if size > c.maxBytes {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok == true {
+		c.removeElement(el)
+	}
+
+	entry := &lruCacheEntry{key: key, value: value, size: size, expires: time.Now().Add(c.ttl)}
+
+	c.entries[key] = c.ll.PushFront(entry)
+	c.stats.Entries++
+	c.stats.Bytes += size
+
+	for c.stats.Entries > c.maxEntries || c.stats.Bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *lruCache) getStats() lruCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
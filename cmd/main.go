@@ -3,16 +3,23 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ginprometheus "github.com/zsais/go-gin-prometheus"
 )
 
 /**
  * Main entry point for the web service
  */
 func main() {
+	// structured logging from the start; format and level are adjusted once configured
+	setupLogging(loggingFormatJSON)
+
 	log.Printf("===> virgo4-shelf-browse-ws starting up <===")
 
 	cfg := loadConfig()
@@ -21,7 +28,27 @@ func main() {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
 
-	router := gin.Default()
+	router := svc.newRouter()
+
+	if errs := svc.openAPI.validateRoutes(router.Routes()); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("[OPENAPI] %s", err)
+		}
+		log.Printf("[OPENAPI] exiting due to error(s) above")
+		os.Exit(1)
+	}
+
+	portStr := fmt.Sprintf(":%s", svc.config.Port)
+	log.Printf("[MAIN] listening on %s", portStr)
+
+	log.Fatal(router.Run(portStr))
+}
+
+func (p *serviceContext) newRouter() *gin.Engine {
+	// requests are logged by our own (structured) request handler instead of gin's logger
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(p.requestHandler)
 
 	router.Use(gzip.Gzip(gzip.DefaultCompression))
 
@@ -31,30 +58,49 @@ func main() {
 	corsCfg.AddAllowHeaders("Authorization")
 	router.Use(cors.New(corsCfg))
 
-	//
-	// we are removing Prometheus support for now
-	//
-	//p := ginprometheus.NewPrometheus("gin")
+	prom := ginprometheus.NewPrometheus("gin")
+
+	// label requests by route rather than by url, so that record ids do not become labels
+	prom.ReqCntURLLabelMappingFn = func(c *gin.Context) string {
+		if route := c.FullPath(); route != "" {
+			return route
+		}
+		return "unmatched"
+	}
 
 	// roundabout setup of /metrics endpoint to avoid double-gzip of response
-	//router.Use(p.HandlerFunc())
-	//h := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true}))
+	router.Use(prom.HandlerFunc())
+	h := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true}))
 
-	//router.GET(p.MetricsPath, func(c *gin.Context) {
-	//	h.ServeHTTP(c.Writer, c.Request)
-	//})
+	router.GET(prom.MetricsPath, func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	})
 
-	router.GET("/favicon.ico", svc.ignoreHandler)
+	// routes from here on are traced
+	router.Use(p.tracingHandler)
 
-	router.GET("/version", svc.versionHandler)
-	router.GET("/healthcheck", svc.healthCheckHandler)
+	router.GET("/favicon.ico", p.ignoreHandler)
+
+	router.GET("/version", p.versionHandler)
+	router.GET("/healthcheck", p.healthCheckHandler)
 
 	if api := router.Group("/api"); api != nil {
-		api.GET("/browse/:id", svc.authenticateHandler, svc.browseHandler)
+		api.GET("/openapi.json", p.openAPIHandler)
+		api.GET("/browse/:id", p.authenticateHandler, p.browseHandler)
+		api.POST("/browse", p.authenticateHandler, p.batchBrowseHandler)
+		api.POST("/shelf", p.authenticateHandler, p.virtualShelfHandler)
+		api.GET("/classification", p.authenticateHandler, p.classificationHandler)
+		api.GET("/cover/:id", p.coverAuthHandler, p.coverHandler)
 	}
 
-	portStr := fmt.Sprintf(":%s", svc.config.Port)
-	log.Printf("[MAIN] listening on %s", portStr)
+	router.GET("/widget/:id", p.widgetAuthHandler, p.widgetHandler)
 
-	log.Fatal(router.Run(portStr))
+	if admin := router.Group("/admin"); admin != nil {
+		admin.GET("/config", p.authenticateHandler, p.requireAdminHandler, p.adminConfigHandler)
+		admin.GET("/cache", p.authenticateHandler, p.requireAdminHandler, p.adminCacheHandler)
+		admin.GET("/loglevel", p.authenticateHandler, p.requireAdminHandler, p.adminLogLevelHandler)
+		admin.PUT("/loglevel", p.authenticateHandler, p.requireAdminHandler, p.adminLogLevelHandler)
+	}
+
+	return router
 }
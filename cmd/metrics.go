@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+const metricsNamespace = "shelf_browse"
+
+// authentication outcomes, as reported in metrics and the audit log
+const (
+	authSuccess         = "success"
+	authMissingHeader   = "missing_header"
+	authMalformedHeader = "malformed_header"
+	authMissingToken    = "missing_token"
+	authExpiredToken    = "expired_token"
+	authBadSignature    = "bad_signature"
+	authMalformedToken  = "malformed_token"
+	authBadVersion      = "bad_version"
+	authInvalidToken    = "invalid_token"
+	authNotAdmin        = "not_admin"
+	authBadURLSignature = "bad_url_signature"
+	authExpiredURL      = "expired_url"
+	authUnsignedURL     = "unsigned_url"
+)
+
+type serviceMetrics struct {
+	solrRequests     *prometheus.HistogramVec
+	termsOverage     *prometheus.HistogramVec
+	termsHitRatio    *prometheus.GaugeVec
+	itemsRequested   *prometheus.CounterVec
+	itemsReturned    *prometheus.CounterVec
+	browseFill       *prometheus.HistogramVec
+	coverURLFailures *prometheus.CounterVec
+	authOutcomes     *prometheus.CounterVec
+}
+
+// metrics live in the default registry, which is process-wide, so they are only created once
+var (
+	metricsOnce            sync.Once
+	serviceMetricsInstance *serviceMetrics
+)
+
+func (p *serviceContext) initMetrics() {
+	metricsOnce.Do(func() {
+		serviceMetricsInstance = newServiceMetrics()
+	})
+
+	p.metrics = serviceMetricsInstance
+}
+
+func newServiceMetrics() *serviceMetrics {
+	m := serviceMetrics{
+		solrRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "solr_request_duration_seconds",
+			Help:      "Duration of Solr requests, by client and outcome.",
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"client", "outcome"}),
+
+		termsOverage: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "terms_overage",
+			Help:      "Shelf keys requested from Solr but never examined, per walk.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		}, []string{"field"}),
+
+		termsHitRatio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "terms_hit_ratio",
+			Help:      "Learned fraction of shelf keys that have a matching record.",
+		}, []string{"field"}),
+
+		itemsRequested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "items_requested_total",
+			Help:      "Items requested along the shelf, by walk field.",
+		}, []string{"field"}),
+
+		itemsReturned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "items_returned_total",
+			Help:      "Items returned along the shelf, by walk field.",
+		}, []string{"field"}),
+
+		browseFill: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "walk_fill_ratio",
+			Help:      "Fraction of the requested items returned, per walk.",
+			Buckets:   []float64{0, 0.25, 0.5, 0.75, 0.9, 1},
+		}, []string{"field"}),
+
+		coverURLFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cover_url_failures_total",
+			Help:      "Cover image urls that could not be built, by provider.",
+		}, []string{"provider"}),
+
+		authOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_outcomes_total",
+			Help:      "Authentication and authorization outcomes: successes, and failures by reason.",
+		}, []string{"reason"}),
+	}
+
+	prometheus.MustRegister(m.solrRequests, m.termsOverage, m.termsHitRatio, m.itemsRequested, m.itemsReturned,
+		m.browseFill, m.coverURLFailures, m.authOutcomes)
+
+	return &m
+}
+
+func (m *serviceMetrics) observeSolrRequest(client string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	m.solrRequests.WithLabelValues(client, outcome).Observe(time.Since(start).Seconds())
+}
+
+func (m *serviceMetrics) observeWalk(field string, status shelfBrowseDirectionStatus, hitRatio float64) {
+	m.termsHitRatio.WithLabelValues(field).Set(hitRatio)
+	m.termsOverage.WithLabelValues(field).Observe(float64(status.TermsRequested - status.TermsExamined))
+	m.itemsRequested.WithLabelValues(field).Add(float64(status.Requested))
+	m.itemsReturned.WithLabelValues(field).Add(float64(status.Returned))
+
+	if status.Requested > 0 {
+		m.browseFill.WithLabelValues(field).Observe(status.Fill)
+	}
+}
+
+func authTokenFailureReason(err error) string {
+	var versionErr *v4jwt.VersionError
+
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return authExpiredToken
+
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return authBadSignature
+
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return authMalformedToken
+
+	case errors.As(err, &versionErr):
+		return authBadVersion
+	}
+
+	return authInvalidToken
+}
+
+func authHeaderFailureReason(authorization string) string {
+	if strings.TrimSpace(authorization) == "" {
+		return authMissingHeader
+	}
+
+	return authMalformedHeader
+}
+
+func authURLFailureReason(err error) string {
+	switch {
+	case errors.Is(err, coversign.ErrExpired):
+		return authExpiredURL
+
+	case errors.Is(err, coversign.ErrUnsigned):
+		return authUnsignedURL
+	}
+
+	return authBadURLSignature
+}
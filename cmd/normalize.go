@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/uvalib/virgo4-shelf-browse-ws/normalize"
+)
+
+// value normalizations, for values sent to cover providers and optionally for output fields
+const (
+	normalizeISBN = "isbn"
+	normalizeOCLC = "oclc"
+	normalizeLCCN = "lccn"
+	normalizeUPC  = "upc"
+	normalizeISSN = "issn"
+
+	normalizeAuthor         = "author"          // name heading without dates, relator terms, etc.
+	normalizeAuthorInverted = "author_inverted" // the same, in display order
+)
+
+var valueNormalizers = map[string]func(string) (string, bool){
+	normalizeISBN: normalize.ISBN,
+	normalizeOCLC: normalize.OCLC,
+	normalizeLCCN: normalize.LCCN,
+	normalizeUPC:  normalize.UPC,
+	normalizeISSN: normalize.ISSN,
+
+	normalizeAuthor: func(val string) (string, bool) {
+		author := normalize.Author(val)
+		return author, author != ""
+	},
+
+	normalizeAuthorInverted: func(val string) (string, bool) {
+		author := normalize.InvertName(normalize.Author(val))
+		return author, author != ""
+	},
+}
+
+func valueNormalizations() []string {
+	var names []string
+
+	for name := range valueNormalizers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func normalizedValues(doc *solrDocument, field, normalization string) []string {
+	// valid values of the field in canonical form, without duplicates
+
+	return normalize.All(doc.getStrings(field), valueNormalizers[normalization])
+}
+
+func (cfg serviceConfigCoverImages) identifiers(doc *solrDocument, kind string) []string {
+	// canonical identifiers of the given kind, from the configured field for that kind
+
+	fields := map[string]string{
+		normalizeISBN: cfg.ISBNField,
+		normalizeOCLC: cfg.OCLCField,
+		normalizeLCCN: cfg.LCCNField,
+		normalizeUPC:  cfg.UPCField,
+		normalizeISSN: cfg.ISSNField,
+	}
+
+	return normalizedValues(doc, fields[kind], kind)
+}
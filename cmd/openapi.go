@@ -0,0 +1,733 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+const openAPIPath = "/api/openapi.json"
+
+// routes that are intentionally left out of the api description
+var openAPIUndocumented = []string{"/favicon.ico"}
+
+type openAPISchema struct {
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Maximum              *int                      `json:"maximum,omitempty"`
+	Default              any                       `json:"default,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Ref                  string                    `json:"$ref,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema,omitempty"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	operations map[string]*openAPIOperation            // internally set; keyed by operation id
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func jsonContent(schema *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+func openAPIPathFromRoute(route string) string {
+	// convert gin path parameters (":id") to openapi ones ("{id}")
+
+	parts := strings.Split(route, "/")
+
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func (d *openAPIDocument) addOperation(method, route string, op *openAPIOperation) {
+	path := openAPIPathFromRoute(route)
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*openAPIOperation)
+	}
+
+	d.Paths[path][strings.ToLower(method)] = op
+	d.operations[op.OperationID] = op
+}
+
+func (p *serviceContext) initOpenAPI() {
+	cfg := p.config.Solr.ShelfBrowse
+
+	doc := openAPIDocument{
+		OpenAPI:    "3.0.3",
+		Info:       openAPIInfo{Title: "Virgo4 Shelf Browse Web Service", Version: p.version.BuildVersion},
+		Paths:      make(map[string]map[string]*openAPIOperation),
+		operations: make(map[string]*openAPIOperation),
+	}
+
+	// schemas
+
+	rangeSchema := &openAPISchema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(cfg.MaxItems), Default: cfg.DefaultItems}
+
+	itemProps := make(map[string]*openAPISchema)
+	for _, field := range p.config.Fields {
+		itemProps[field.Name] = &openAPISchema{Type: "string", Description: fmt.Sprintf("from solr field %s", field.Field)}
+		if field.Normalize != "" {
+			itemProps[field.Name].Description += fmt.Sprintf(", as a normalized %s", field.Normalize)
+		}
+	}
+
+	if itemProps[fieldCoverImageURL] != nil && itemProps[fieldCoverImageFallbacks] == nil {
+		itemProps[fieldCoverImageFallbacks] = &openAPISchema{Type: "string", Description: "space-separated fallback cover image urls, in order of preference"}
+	}
+
+	if p.config.Classification.CallNumberField != "" {
+		for name, desc := range map[string]string{fieldLCClass: "lc class", fieldLCSubclass: "lc subclass", fieldLCLabel: "label of the narrowest matching lc outline entry"} {
+			if itemProps[name] == nil {
+				itemProps[name] = &openAPISchema{Type: "string", Description: fmt.Sprintf("%s, from solr field %s", desc, p.config.Classification.CallNumberField)}
+			}
+		}
+	}
+
+	doc.Components.Schemas = map[string]*openAPISchema{
+		"shelfBrowseItem": {
+			Type:                 "object",
+			Description:          "a single record on the shelf, containing the configured output fields",
+			Properties:           itemProps,
+			AdditionalProperties: &openAPISchema{Type: "string"},
+		},
+		"shelfBrowseDirectionStatus": {
+			Type:        "object",
+			Description: "outcome of walking the shelf in one direction from the item",
+			Properties: map[string]*openAPISchema{
+				"status_code":     {Type: "integer", Description: "http status code"},
+				"status_msg":      {Type: "string", Description: "error message, if any"},
+				"requested":       {Type: "integer", Description: "items requested in this direction"},
+				"returned":        {Type: "integer", Description: "items found in this direction"},
+				"fill":            {Type: "number", Description: "fraction of requested items found"},
+				"terms_requested": {Type: "integer", Description: "shelf keys requested from solr"},
+				"terms_examined":  {Type: "integer", Description: "shelf keys looked up"},
+			},
+			Required: []string{"status_code", "requested", "returned", "fill"},
+		},
+		"shelfBrowseDebug": {
+			Type:        "object",
+			Description: "diagnostics, included when the debug option is set",
+			Properties: map[string]*openAPISchema{
+				"duplicates": {
+					Type:        "array",
+					Description: "records skipped because they were already in the window",
+					Items: &openAPISchema{
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"id":    {Type: "string", Description: "record id"},
+							"field": {Type: "string", Description: "shelf key field"},
+							"key":   {Type: "string", Description: "shelf key at which the record was found again"},
+						},
+					},
+				},
+			},
+		},
+		"lcOutlineEntry": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"type":  {Type: "string", Enum: []string{lcOutlineClass, lcOutlineSubclass, lcOutlineRange}},
+				"code":  {Type: "string", Description: "class letters, and class number range if any"},
+				"label": {Type: "string"},
+			},
+			Required: []string{"type", "code", "label"},
+		},
+		"shelfBrowseSection": {
+			Type:        "object",
+			Description: "the start of a run of items sharing the same lc classification",
+			Properties: map[string]*openAPISchema{
+				"start_index": {Type: "integer", Description: "index within items of the first item in the section"},
+				"lc_class":    {Type: "string"},
+				"lc_subclass": {Type: "string"},
+				"code":        {Type: "string", Description: "code of the narrowest matching outline entry"},
+				"label":       {Type: "string", Description: "label of the narrowest matching outline entry"},
+			},
+			Required: []string{"start_index", "lc_class", "lc_subclass", "code", "label"},
+		},
+		"classificationResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"call_number": {Type: "string"},
+				"lc_class":    {Type: "string"},
+				"lc_subclass": {Type: "string"},
+				"code":        {Type: "string", Description: "code of the narrowest matching outline entry"},
+				"lc_label":    {Type: "string", Description: "label of the narrowest matching outline entry"},
+				"hierarchy":   {Type: "array", Items: schemaRef("lcOutlineEntry"), Description: "matching outline entries, broadest first"},
+				"status_code": {Type: "integer", Description: "http status code"},
+				"status_msg":  {Type: "string", Description: "error message, if any"},
+				"details":     {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "details about invalid parameters, if any"},
+			},
+			Required: []string{"status_code"},
+		},
+		"coverResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"status_code": {Type: "integer", Description: "http status code"},
+				"status_msg":  {Type: "string", Description: "error message, if any"},
+				"details":     {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "details about invalid parameters, if any"},
+			},
+			Required: []string{"status_code"},
+		},
+		"shelfBrowseResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"items":          {Type: "array", Items: schemaRef("shelfBrowseItem"), Description: "records in shelf order"},
+				"status_code":    {Type: "integer", Description: "http status code"},
+				"status_msg":     {Type: "string", Description: "error message, if any"},
+				"details":        {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "details about invalid parameters, if any"},
+				"reverse_status": schemaRef("shelfBrowseDirectionStatus"),
+				"forward_status": schemaRef("shelfBrowseDirectionStatus"),
+				"focus_index":    {Type: "integer", Description: "index within items of the requested item"},
+				"more_before":    {Type: "boolean", Description: "true if the shelf continues before the first item"},
+				"more_after":     {Type: "boolean", Description: "true if the shelf continues after the last item"},
+				"first_key":      {Type: "string", Description: "reverse shelf key at which the first item was found"},
+				"last_key":       {Type: "string", Description: "forward shelf key at which the last item was found"},
+				"sections":       {Type: "array", Items: schemaRef("shelfBrowseSection"), Description: "points within items at which the lc classification changes"},
+				"partial":        {Type: "boolean", Description: "true if either direction could not be completely walked"},
+				"debug":          schemaRef("shelfBrowseDebug"),
+				"stale":          {Type: "boolean", Description: "true if solr was unavailable and this is the last successful response for the item"},
+				"stale_age":      {Type: "integer", Description: "age of a stale response, in seconds"},
+			},
+			Required: []string{"status_code"},
+		},
+		"shelfBrowseBatchRequestItem": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"id":    {Type: "string", Description: "record id"},
+				"range": rangeSchema,
+			},
+			Required: []string{"id"},
+		},
+		"shelfBrowseBatchRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"items": {Type: "array", Items: schemaRef("shelfBrowseBatchRequestItem"), Description: fmt.Sprintf("up to %d items to browse", cfg.MaxBatchIDs)},
+			},
+			Required: []string{"items"},
+		},
+		"shelfBrowseBatchResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"results":     {Type: "object", AdditionalProperties: schemaRef("shelfBrowseResponse"), Description: "shelf browse results keyed by requested id"},
+				"total_items": {Type: "integer", Description: fmt.Sprintf("total items across all results; at most %d", cfg.MaxBatchItems)},
+				"status_code": {Type: "integer", Description: "http status code"},
+				"status_msg":  {Type: "string", Description: "error message, if any"},
+				"details":     {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "details about an invalid request, if any"},
+			},
+			Required: []string{"status_code", "total_items"},
+		},
+		"virtualShelfRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"ids":       {Type: "array", Items: &openAPISchema{Type: "string"}, Description: fmt.Sprintf("up to %d record ids", cfg.MaxVirtualIDs)},
+				"neighbors": {Type: "boolean", Default: false, Description: "also return the nearest records on either side of each item that are not in the list"},
+			},
+			Required: []string{"ids"},
+		},
+		"virtualShelfNeighbors": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"before": schemaRef("shelfBrowseItem"),
+				"after":  schemaRef("shelfBrowseItem"),
+			},
+		},
+		"virtualShelfResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"items":       {Type: "array", Items: schemaRef("shelfBrowseItem"), Description: "listed records with shelf keys, in shelf order"},
+				"sections":    {Type: "array", Items: schemaRef("shelfBrowseSection"), Description: "points within items at which the lc classification changes"},
+				"neighbors":   {Type: "object", AdditionalProperties: schemaRef("virtualShelfNeighbors"), Description: "shelf neighbors keyed by item id, if requested"},
+				"unshelved":   {Type: "array", Items: schemaRef("shelfBrowseItem"), Description: "listed records without shelf keys"},
+				"not_found":   {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "listed ids with no matching record"},
+				"status_code": {Type: "integer", Description: "http status code"},
+				"status_msg":  {Type: "string", Description: "error message, if any"},
+				"details":     {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "details about an invalid request, if any"},
+			},
+			Required: []string{"status_code"},
+		},
+		"versionResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"build":      {Type: "string"},
+				"go_version": {Type: "string"},
+				"git_commit": {Type: "string"},
+			},
+		},
+		"healthCheckResponse": {
+			Type: "object",
+			AdditionalProperties: &openAPISchema{
+				Type: "object",
+				Properties: map[string]*openAPISchema{
+					"healthy": {Type: "boolean"},
+					"message": {Type: "string"},
+				},
+				Required: []string{"healthy"},
+			},
+		},
+		"cacheStats": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"entries":       {Type: "integer"},
+				"bytes":         {Type: "integer"},
+				"hits":          {Type: "integer"},
+				"misses":        {Type: "integer"},
+				"evictions":     {Type: "integer"},
+				"expirations":   {Type: "integer"},
+				"invalidations": {Type: "integer", Description: "times the cache was emptied due to a solr index version change"},
+				"index_version": {Type: "integer", Description: "solr index version of the cached entries"},
+			},
+		},
+		"adminCacheResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"terms": schemaRef("cacheStats"),
+				"items": schemaRef("cacheStats"),
+			},
+		},
+		"logLevelRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"level": {Type: "string", Description: "new log level: debug, info, warn or error"},
+			},
+			Required: []string{"level"},
+		},
+		"logLevelResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"level":       {Type: "string", Description: "current log level"},
+				"status_code": {Type: "integer", Description: "http status code"},
+				"status_msg":  {Type: "string", Description: "error message, if any"},
+			},
+			Required: []string{"status_code"},
+		},
+		"adminConfigResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"config":  {Type: "object", Description: "effective configuration, with secrets redacted"},
+				"sources": {Type: "object", AdditionalProperties: &openAPISchema{Type: "string"}, Description: "source of each configured value"},
+			},
+		},
+	}
+
+	doc.Components.SecuritySchemes = map[string]openAPISecurityScheme{
+		"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	}
+
+	bearer := []map[string][]string{{"bearerAuth": {}}}
+
+	debugParams := []openAPIParameter{
+		{Name: "debug", In: "query", Description: "add debug information to the response", Schema: &openAPISchema{Type: "boolean", Default: false}},
+		{Name: "verbose", In: "query", Description: "log verbose solr requests/responses", Schema: &openAPISchema{Type: "boolean", Default: false}},
+	}
+
+	// operations
+
+	doc.addOperation(http.MethodGet, "/version", &openAPIOperation{
+		OperationID: "getVersion",
+		Summary:     "returns build version",
+		Tags:        []string{"service"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "build version", Content: jsonContent(schemaRef("versionResponse"))},
+		},
+	})
+
+	doc.addOperation(http.MethodGet, "/healthcheck", &openAPIOperation{
+		OperationID: "getHealthCheck",
+		Summary:     "returns health check information",
+		Tags:        []string{"service"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "all dependencies are healthy", Content: jsonContent(schemaRef("healthCheckResponse"))},
+			"500": {Description: "one or more dependencies are unhealthy", Content: jsonContent(schemaRef("healthCheckResponse"))},
+		},
+	})
+
+	doc.addOperation(http.MethodGet, "/metrics", &openAPIOperation{
+		OperationID: "getMetrics",
+		Summary:     "returns Prometheus metrics",
+		Tags:        []string{"service"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "metrics in the Prometheus text exposition format", Content: map[string]openAPIMediaType{"text/plain": {Schema: &openAPISchema{Type: "string"}}}},
+		},
+	})
+
+	doc.addOperation(http.MethodGet, openAPIPath, &openAPIOperation{
+		OperationID: "getOpenAPI",
+		Summary:     "returns this api description",
+		Tags:        []string{"service"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "openapi 3 document", Content: jsonContent(&openAPISchema{Type: "object"})},
+		},
+	})
+
+	doc.addOperation(http.MethodGet, "/api/browse/:id", &openAPIOperation{
+		OperationID: "getShelfBrowse",
+		Summary:     "returns shelf browse information for records surrounding the given item",
+		Tags:        []string{"browse"},
+		Parameters: append([]openAPIParameter{
+			{Name: "id", In: "path", Description: "record id", Required: true, Schema: &openAPISchema{Type: "string"}},
+			{Name: "range", In: "query", Description: "maximum number of records to return on either side of the item", Schema: rangeSchema},
+			{Name: "If-None-Match", In: "header", Description: "etag(s) of previously received representations", Schema: &openAPISchema{Type: "string"}},
+			{Name: "format", In: "query", Description: "response format; overrides the Accept header", Schema: &openAPISchema{Type: "string", Enum: browseFormats, Default: formatJSON}},
+		}, debugParams...),
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "shelf browse results, in the requested format", Content: map[string]openAPIMediaType{
+				browseFormatMimeTypes[formatJSON]:   {Schema: schemaRef("shelfBrowseResponse")},
+				browseFormatMimeTypes[formatCSV]:    {Schema: &openAPISchema{Type: "string", Description: "one row per item, one column per output field"}},
+				browseFormatMimeTypes[formatJSONLD]: {Schema: &openAPISchema{Type: "object", Description: "schema.org ItemList"}},
+				browseFormatMimeTypes[formatAtom]:   {Schema: &openAPISchema{Type: "string", Description: "atom feed with one entry per item"}},
+			}},
+			"304": {Description: "the representation matching If-None-Match is still current"},
+			"400": {Description: "invalid parameters", Content: jsonContent(schemaRef("shelfBrowseResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"406": {Description: "none of the accepted formats are supported", Content: jsonContent(schemaRef("shelfBrowseResponse"))},
+			"404": {Description: "record not found, or record has no shelf keys", Content: jsonContent(schemaRef("shelfBrowseResponse"))},
+			"500": {Description: "internal error", Content: jsonContent(schemaRef("shelfBrowseResponse"))},
+		},
+		Security: bearer,
+	})
+
+	widgetOp := &openAPIOperation{
+		OperationID: "getShelfWidget",
+		Summary:     "returns an embeddable html shelf for the records surrounding the given item",
+		Tags:        []string{"widget"},
+		Parameters: []openAPIParameter{
+			{Name: "id", In: "path", Description: "record id", Required: true, Schema: &openAPISchema{Type: "string"}},
+			{Name: "range", In: "query", Description: "maximum number of records to show on either side of the item", Schema: rangeSchema},
+		},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "html shelf", Content: map[string]openAPIMediaType{"text/html": {Schema: &openAPISchema{Type: "string"}}}},
+			"400": {Description: "invalid parameters", Content: map[string]openAPIMediaType{"text/html": {Schema: &openAPISchema{Type: "string"}}}},
+			"404": {Description: "record not found, or record has no shelf keys", Content: map[string]openAPIMediaType{"text/html": {Schema: &openAPISchema{Type: "string"}}}},
+		},
+	}
+
+	switch p.config.Widget.AuthMode {
+	case widgetAuthHeader:
+		widgetOp.Security = append([]map[string][]string{{}}, bearer...)
+
+	case widgetAuthQuery:
+		widgetOp.Parameters = append(widgetOp.Parameters, openAPIParameter{Name: "token", In: "query", Description: "bearer token; not needed with a signed url", Schema: &openAPISchema{Type: "string"}})
+	}
+
+	// links between widget pages are signed, and accepted in place of a bearer token
+	if p.config.Widget.AuthMode != widgetAuthNone {
+		widgetOp.Parameters = append(widgetOp.Parameters,
+			openAPIParameter{Name: coversign.ExpiresParam, In: "query", Description: "expiration time of a signed url (unix time)", Schema: &openAPISchema{Type: "integer"}},
+			openAPIParameter{Name: coversign.SignatureParam, In: "query", Description: "signature of a signed url", Schema: &openAPISchema{Type: "string"}},
+		)
+		widgetOp.Responses["401"] = openAPIResponse{Description: "missing or invalid authentication"}
+		widgetOp.Responses["403"] = openAPIResponse{Description: "invalid or expired url signature"}
+	}
+
+	doc.addOperation(http.MethodGet, "/widget/:id", widgetOp)
+
+	doc.addOperation(http.MethodPost, "/api/browse", &openAPIOperation{
+		OperationID: "postShelfBrowseBatch",
+		Summary:     "returns shelf browse information for several items at once",
+		Tags:        []string{"browse"},
+		Parameters:  debugParams,
+		RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("shelfBrowseBatchRequest"))},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "shelf browse results for each item", Content: jsonContent(schemaRef("shelfBrowseBatchResponse"))},
+			"400": {Description: "invalid request", Content: jsonContent(schemaRef("shelfBrowseBatchResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+		},
+		Security: bearer,
+	})
+
+	doc.addOperation(http.MethodPost, "/api/shelf", &openAPIOperation{
+		OperationID: "postVirtualShelf",
+		Summary:     "returns the given records in shelf order",
+		Tags:        []string{"browse"},
+		Parameters:  debugParams,
+		RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("virtualShelfRequest"))},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "the records in shelf order", Content: jsonContent(schemaRef("virtualShelfResponse"))},
+			"400": {Description: "invalid request", Content: jsonContent(schemaRef("virtualShelfResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"500": {Description: "internal error", Content: jsonContent(schemaRef("virtualShelfResponse"))},
+		},
+		Security: bearer,
+	})
+
+	doc.addOperation(http.MethodGet, "/api/classification", &openAPIOperation{
+		OperationID: "getClassification",
+		Summary:     "returns the lc outline hierarchy for a call number",
+		Tags:        []string{"browse"},
+		Parameters: []openAPIParameter{
+			{Name: "call_number", In: "query", Description: "lc call number", Required: true, Schema: &openAPISchema{Type: "string"}},
+		},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "outline hierarchy", Content: jsonContent(schemaRef("classificationResponse"))},
+			"400": {Description: "invalid parameters", Content: jsonContent(schemaRef("classificationResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"404": {Description: "call number is not in the lc outline", Content: jsonContent(schemaRef("classificationResponse"))},
+		},
+		Security: bearer,
+	})
+
+	coverOp := &openAPIOperation{
+		OperationID: "getCoverImage",
+		Summary:     "returns the cover image for a record, or a generated placeholder showing its title and call number",
+		Tags:        []string{"covers"},
+		Parameters: []openAPIParameter{
+			{Name: "id", In: "path", Description: "record id", Required: true, Schema: &openAPISchema{Type: "string"}},
+		},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "cover image; placeholders are image/svg+xml and carry an X-Cover-Placeholder header", Content: map[string]openAPIMediaType{"image/*": {Schema: &openAPISchema{Type: "string", Format: "binary"}}}},
+			"400": {Description: "invalid parameters", Content: jsonContent(schemaRef("coverResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"404": {Description: "record not found", Content: jsonContent(schemaRef("coverResponse"))},
+			"500": {Description: "internal error", Content: jsonContent(schemaRef("coverResponse"))},
+		},
+		Security: bearer,
+	}
+
+	// signed urls are accepted in place of a bearer token
+	if p.config.Solr.CoverImages.SigningKey != "" {
+		coverOp.Parameters = append(coverOp.Parameters,
+			openAPIParameter{Name: coversign.ExpiresParam, In: "query", Description: "expiration time of a signed url (unix time)", Schema: &openAPISchema{Type: "integer"}},
+			openAPIParameter{Name: coversign.SignatureParam, In: "query", Description: "signature of a signed url", Schema: &openAPISchema{Type: "string"}},
+		)
+		coverOp.Responses["403"] = openAPIResponse{Description: "invalid or expired url signature"}
+		coverOp.Security = append([]map[string][]string{{}}, bearer...)
+	}
+
+	doc.addOperation(http.MethodGet, "/api/cover/:id", coverOp)
+
+	doc.addOperation(http.MethodGet, "/admin/config", &openAPIOperation{
+		OperationID: "getAdminConfig",
+		Summary:     "returns the effective configuration, with secrets redacted",
+		Tags:        []string{"admin"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "effective configuration", Content: jsonContent(schemaRef("adminConfigResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"403": {Description: "admin role required"},
+		},
+		Security: bearer,
+	})
+
+	doc.addOperation(http.MethodGet, "/admin/cache", &openAPIOperation{
+		OperationID: "getAdminCache",
+		Summary:     "returns result cache statistics",
+		Tags:        []string{"admin"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "result cache statistics", Content: jsonContent(schemaRef("adminCacheResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"403": {Description: "admin role required"},
+		},
+		Security: bearer,
+	})
+
+	doc.addOperation(http.MethodGet, "/admin/loglevel", &openAPIOperation{
+		OperationID: "getAdminLogLevel",
+		Summary:     "returns the current log level",
+		Tags:        []string{"admin"},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "current log level", Content: jsonContent(schemaRef("logLevelResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"403": {Description: "admin role required"},
+		},
+		Security: bearer,
+	})
+
+	doc.addOperation(http.MethodPut, "/admin/loglevel", &openAPIOperation{
+		OperationID: "putAdminLogLevel",
+		Summary:     "changes the log level until the service restarts",
+		Tags:        []string{"admin"},
+		RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("logLevelRequest"))},
+		Responses: map[string]openAPIResponse{
+			"200": {Description: "new log level", Content: jsonContent(schemaRef("logLevelResponse"))},
+			"400": {Description: "invalid log level", Content: jsonContent(schemaRef("logLevelResponse"))},
+			"401": {Description: "missing or invalid authentication"},
+			"403": {Description: "admin role required"},
+		},
+		Security: bearer,
+	})
+
+	p.openAPI = &doc
+}
+
+func (d *openAPIDocument) validateRoutes(routes gin.RoutesInfo) []string {
+	// describes any disagreement between the api description and the router
+
+	var errs []string
+
+	routed := make(map[string]bool)
+
+	for _, route := range routes {
+		if sliceContainsString(openAPIUndocumented, route.Path) == true {
+			continue
+		}
+
+		path := openAPIPathFromRoute(route.Path)
+		method := strings.ToLower(route.Method)
+
+		routed[method+" "+path] = true
+
+		if d.Paths[path] == nil || d.Paths[path][method] == nil {
+			errs = append(errs, fmt.Sprintf("route %s %s is not described", route.Method, route.Path))
+		}
+	}
+
+	for path, ops := range d.Paths {
+		for method := range ops {
+			if routed[method+" "+path] == false {
+				errs = append(errs, fmt.Sprintf("described operation %s %s is not routed", strings.ToUpper(method), path))
+			}
+		}
+	}
+
+	sort.Strings(errs)
+
+	return errs
+}
+
+func (s *openAPISchema) validate(name, value string) string {
+	// returns a description of why the value does not match the schema, if it does not
+
+	switch s.Type {
+	case "integer":
+		val, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Sprintf("%s: [%s] is not an integer", name, value)
+		}
+
+		if s.Minimum != nil && val < *s.Minimum {
+			return fmt.Sprintf("%s: %d is less than the minimum of %d", name, val, *s.Minimum)
+		}
+
+		if s.Maximum != nil && val > *s.Maximum {
+			return fmt.Sprintf("%s: %d is greater than the maximum of %d", name, val, *s.Maximum)
+		}
+
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("%s: [%s] is not a boolean", name, value)
+		}
+
+	case "string":
+		if len(s.Enum) > 0 && sliceContainsString(s.Enum, value) == false {
+			return fmt.Sprintf("%s: [%s] is not one of: %s", name, value, strings.Join(s.Enum, ", "))
+		}
+	}
+
+	return ""
+}
+
+func (d *openAPIDocument) validateRequest(c *gin.Context, operationID string) []string {
+	// validate path and query parameters against the described operation
+
+	var errs []string
+
+	op := d.operations[operationID]
+	if op == nil {
+		return errs
+	}
+
+	for _, param := range op.Parameters {
+		var value string
+		var present bool
+
+		switch param.In {
+		case "path":
+			value = c.Param(param.Name)
+			present = value != ""
+
+		case "query":
+			// an empty value is treated the same as an absent one
+			value = c.Query(param.Name)
+			present = value != ""
+
+		default:
+			continue
+		}
+
+		if present == false {
+			if param.Required == true {
+				errs = append(errs, fmt.Sprintf("%s: missing required %s parameter", param.Name, param.In))
+			}
+			continue
+		}
+
+		if msg := param.Schema.validate(param.Name, value); msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+
+	return errs
+}
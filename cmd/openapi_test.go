@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	svc := newTestService(t, testConfig())
+
+	// both directions: every route is described, and every described operation is routed
+	for _, err := range svc.openAPI.validateRoutes(svc.newRouter().Routes()) {
+		t.Error(err)
+	}
+}
+
+func TestOpenAPIDetectsMismatches(t *testing.T) {
+	svc := newTestService(t, testConfig())
+
+	router := svc.newRouter()
+	router.GET("/api/undescribed", svc.ignoreHandler)
+
+	delete(svc.openAPI.Paths, "/version")
+
+	errs := svc.openAPI.validateRoutes(router.Routes())
+
+	want := []string{
+		"route GET /api/undescribed is not described",
+		"route GET /version is not described",
+	}
+
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %q, want %q", errs, want)
+	}
+
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("error %d: got %q, want %q", i, errs[i], want[i])
+		}
+	}
+
+	svc = newTestService(t, testConfig())
+	svc.openAPI.Paths["/api/missing"] = svc.openAPI.Paths["/version"]
+
+	errs = svc.openAPI.validateRoutes(svc.newRouter().Routes())
+
+	if len(errs) != 1 || errs[0] != "described operation GET /api/missing is not routed" {
+		t.Errorf("got errors %q, want the unrouted operation reported", errs)
+	}
+}
+
+func TestInvalidRequestsAreRejected(t *testing.T) {
+	cfg := testConfig()
+
+	svc := newTestService(t, cfg)
+	router := svc.newRouter()
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for _, path := range []string{"/api/browse/u1?range=0", "/api/browse/u1?range=abc", "/api/classification"} {
+		w := get(path)
+
+		var res struct {
+			StatusCode int      `json:"status_code"`
+			Details    []string `json:"details"`
+		}
+
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %s", path, err.Error())
+		}
+
+		if w.Code != http.StatusBadRequest || res.StatusCode != http.StatusBadRequest || len(res.Details) == 0 {
+			t.Errorf("%s: got %d %s, want a 400 listing what is invalid", path, w.Code, w.Body.String())
+		}
+	}
+
+	// the widget reports invalid requests as a page
+	if w := get("/widget/u1?range=0&token=" + token); w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("got widget %d %s, want an html 400", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestBrowseRejectsUnparsableRange(t *testing.T) {
+	// requests that bypass validation still cannot pass a bad range through
+
+	svc := newTestService(t, testConfig())
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/browse/u1?range=abc", nil)
+	c.Params = gin.Params{{Key: "id", Value: "u1"}}
+
+	s := &searchContext{svc: svc, client: &clientContext{ginCtx: c}}
+
+	if resp := s.handleBrowseRequest(); resp.status != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.status, http.StatusBadRequest)
+	}
+}
+
+func TestDefaultRangeIsClamped(t *testing.T) {
+	cfg := testConfig()
+	cfg.Solr.ShelfBrowse.DefaultItems = 50
+
+	svc := newTestService(t, cfg)
+
+	if cfg.Solr.ShelfBrowse.DefaultItems != cfg.Solr.ShelfBrowse.MaxItems {
+		t.Errorf("got default range %d, want it clamped to %d", cfg.Solr.ShelfBrowse.DefaultItems, cfg.Solr.ShelfBrowse.MaxItems)
+	}
+
+	for _, param := range svc.openAPI.operations["getShelfBrowse"].Parameters {
+		if param.Name == "range" && param.Schema.Default != *param.Schema.Maximum {
+			t.Errorf("got described default range %v, want %d", param.Schema.Default, *param.Schema.Maximum)
+		}
+	}
+}
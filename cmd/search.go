@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type searchContext struct {
@@ -11,6 +17,8 @@ type searchContext struct {
 	client  *clientContext
 	solrReq *solrRequest
 	solrRes *solrResponse
+	memo    *searchMemo     // optional; shares solr lookups across several browses
+	trace   context.Context // optional; holds the current span, if not the request's
 }
 
 type searchResponse struct {
@@ -25,10 +33,63 @@ type shelfBrowseItem struct {
 	reverseKey string
 }
 
+// the outcome of looking up a single item
+type itemLookup struct {
+	item shelfBrowseItem
+	resp searchResponse
+}
+
+type shelfBrowseDirectionStatus struct {
+	StatusCode     int     `json:"status_code"`
+	StatusMessage  string  `json:"status_msg,omitempty"`
+	Requested      int     `json:"requested"`       // items requested in this direction
+	Returned       int     `json:"returned"`        // items found in this direction
+	Fill           float64 `json:"fill"`            // fraction of requested items found
+	TermsRequested int     `json:"terms_requested"` // shelf keys requested from solr
+	TermsExamined  int     `json:"terms_examined"`  // shelf keys looked up
+	more           bool    // whether the shelf continues past the last item found
+	boundaryKey    string  // shelf key at which the last item was found
+}
+
+type shelfBrowseDuplicate struct {
+	ID    string `json:"id"`
+	Field string `json:"field"`
+	Key   string `json:"key"`
+}
+
+// diagnostics included in responses when requested via the debug option
+type shelfBrowseDebug struct {
+	Duplicates []shelfBrowseDuplicate `json:"duplicates,omitempty"`
+}
+
+// the start of a run of items sharing the same lc classification
+type shelfBrowseSection struct {
+	StartIndex int    `json:"start_index"`
+	Class      string `json:"lc_class"`
+	Subclass   string `json:"lc_subclass"`
+	Code       string `json:"code"`
+	Label      string `json:"label"`
+}
+
 type shelfBrowseResponse struct {
-	Items         []map[string]string `json:"items,omitempty"`
-	StatusCode    int                 `json:"status_code"`
-	StatusMessage string              `json:"status_msg,omitempty"`
+	Items         []map[string]string         `json:"items,omitempty"`
+	StatusCode    int                         `json:"status_code"`
+	StatusMessage string                      `json:"status_msg,omitempty"`
+	Details       []string                    `json:"details,omitempty"`
+	ReverseStatus *shelfBrowseDirectionStatus `json:"reverse_status,omitempty"`
+	ForwardStatus *shelfBrowseDirectionStatus `json:"forward_status,omitempty"`
+	FocusIndex    *int                        `json:"focus_index,omitempty"`
+	MoreBefore    bool                        `json:"more_before,omitempty"`
+	MoreAfter     bool                        `json:"more_after,omitempty"`
+	FirstKey      string                      `json:"first_key,omitempty"`
+	LastKey       string                      `json:"last_key,omitempty"`
+	Sections      []shelfBrowseSection        `json:"sections,omitempty"`
+	Partial       bool                        `json:"partial,omitempty"`
+	Stale         bool                        `json:"stale,omitempty"`
+	StaleAge      int                         `json:"stale_age,omitempty"`
+	Debug         *shelfBrowseDebug           `json:"debug,omitempty"`
+	items         []shelfBrowseItem           // internally set; the records behind Items
+	updated       time.Time                   // internally set; when the index the response came from last changed
 }
 
 func (s *searchContext) init(p *serviceContext, c *clientContext) {
@@ -40,6 +101,10 @@ func (s *searchContext) log(format string, args ...interface{}) {
 	s.client.log(format, args...)
 }
 
+func (s *searchContext) debug(format string, args ...interface{}) {
+	s.client.debug(format, args...)
+}
+
 func (s *searchContext) err(format string, args ...interface{}) {
 	s.client.err(format, args...)
 }
@@ -49,14 +114,14 @@ func (s *searchContext) warn(format string, args ...interface{}) {
 }
 
 func (s *searchContext) performItemQuery(id string) searchResponse {
-	if err := s.solrItemQuery(id); err != nil {
+	if err := s.solrItemQuery(id, 1); err != nil {
 		s.err("query execution error: %s", err.Error())
 		return searchResponse{status: http.StatusInternalServerError, err: err}
 	}
 
 	if s.solrRes.meta.numRows == 0 {
 		err := fmt.Errorf("record not found")
-		s.warn(err.Error())
+		s.warn("%s", err.Error())
 		return searchResponse{status: http.StatusNotFound, err: err}
 	}
 
@@ -64,6 +129,24 @@ func (s *searchContext) performItemQuery(id string) searchResponse {
 }
 
 func (s *searchContext) getItemDetails(field, value string) (shelfBrowseItem, searchResponse) {
+	span, end := s.startSpan("item.lookup", attribute.String("shelf.field", field), attribute.String("shelf.key", value))
+	defer end()
+
+	var item shelfBrowseItem
+	var resp searchResponse
+
+	if s.memo != nil {
+		item, resp = s.memo.getItemDetails(s, field, value)
+	} else {
+		item, resp = s.cachedItemDetails(field, value)
+	}
+
+	span.SetAttributes(attribute.Int("lookup.status", resp.status))
+
+	return item, resp
+}
+
+func (s *searchContext) lookupItemDetails(field, value string) (shelfBrowseItem, searchResponse) {
 	var item shelfBrowseItem
 
 	query := fmt.Sprintf(`%s:"%s"`, field, value)
@@ -80,7 +163,7 @@ func (s *searchContext) getItemDetails(field, value string) (shelfBrowseItem, se
 
 	if item.forwardKey == "" && item.reverseKey == "" {
 		err := fmt.Errorf("item does not have shelf keys")
-		s.warn(err.Error())
+		s.warn("%s", err.Error())
 		return item, searchResponse{status: http.StatusNotFound, err: err}
 	}
 
@@ -90,23 +173,25 @@ func (s *searchContext) getItemDetails(field, value string) (shelfBrowseItem, se
 func (s *searchContext) handleBrowseRequest() searchResponse {
 	id := s.client.ginCtx.Param("id")
 
-	// get requested range
+	// get requested range (already validated against the api description)
 	limit := s.svc.config.Solr.ShelfBrowse.DefaultItems
 	rng := s.client.ginCtx.Query("range")
-	if r, err := strconv.Atoi(rng); rng != "" && err == nil {
-		limit = r
-	}
-
-	// ensure requested range is reasonable
-	switch {
-	case limit <= 0:
-		limit = s.svc.config.Solr.ShelfBrowse.DefaultItems
-	case limit > s.svc.config.Solr.ShelfBrowse.MaxItems:
-		limit = s.svc.config.Solr.ShelfBrowse.MaxItems
+	if rng != "" {
+		val, err := strconv.Atoi(rng)
+		if err != nil {
+			resp := searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid range: %s", rng)}
+			resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: resp.err.Error()}
+			return resp
+		}
+		limit = val
 	}
 
 	s.log("id = [%s]  range = [%s]  limit = [%d]", id, rng, limit)
 
+	return s.withStaleFallback(id, limit, s.coalescedBrowse(id, limit))
+}
+
+func (s *searchContext) browseItem(id string, limit int) searchResponse {
 	thisItem, thisResp := s.getItemDetails("id", id)
 
 	if thisResp.err != nil {
@@ -115,85 +200,240 @@ func (s *searchContext) handleBrowseRequest() searchResponse {
 		return resp
 	}
 
-	// get forward/reverse shelf keys for this item via solr terms query
+	// walk the shelf in each direction.  a failure in one direction
+	// does not prevent returning whatever the other direction found.
 
-	fwdKeys, fwdErr := s.solrTerms(s.svc.config.Solr.ShelfBrowse.ForwardKey, thisItem.forwardKey, limit)
-	if fwdErr != nil {
-		resp := searchResponse{status: http.StatusInternalServerError, err: fwdErr}
-		resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: resp.err.Error()}
-		return resp
-	}
+	cfg := s.svc.config.Solr.ShelfBrowse
 
-	revKeys, revErr := s.solrTerms(s.svc.config.Solr.ShelfBrowse.ReverseKey, thisItem.reverseKey, limit)
-	if revErr != nil {
-		resp := searchResponse{status: http.StatusInternalServerError, err: revErr}
-		resp.data = shelfBrowseResponse{StatusCode: resp.status, StatusMessage: resp.err.Error()}
-		return resp
+	// a record can have several shelf keys, so the same record may be reached more than once
+	seen := map[string]bool{id: true}
+
+	var debug *shelfBrowseDebug
+	if s.client.opts.debug == true {
+		debug = &shelfBrowseDebug{}
 	}
 
+	revItems, revStatus := s.browseDirection(cfg.ReverseKey, thisItem.reverseKey, limit, seen, debug)
+	fwdItems, fwdStatus := s.browseDirection(cfg.ForwardKey, thisItem.forwardKey, limit, seen, debug)
+
 	// build sequential list of items
 
 	var items []shelfBrowseItem
 
-	count := 0
-	for _, key := range revKeys {
-		//s.log("reverse key: [%s]", key)
-		if revItem, revResp := s.getItemDetails(s.svc.config.Solr.ShelfBrowse.ReverseKey, key); revResp.err == nil {
-			items = append([]shelfBrowseItem{revItem}, items...)
-			count++
-			if count >= limit {
-				break
-			}
-		}
+	for i := len(revItems) - 1; i >= 0; i-- {
+		items = append(items, revItems[i])
 	}
 
 	items = append(items, thisItem)
 
-	count = 0
-	for _, key := range fwdKeys {
-		//s.log("forward key: [%s]", key)
-		if fwdItem, fwdResp := s.getItemDetails(s.svc.config.Solr.ShelfBrowse.ForwardKey, key); fwdResp.err == nil {
-			items = append(items, fwdItem)
-			count++
-			if count >= limit {
-				break
-			}
-		}
-	}
+	items = append(items, fwdItems...)
 
 	// populate each item
 
 	var itemMap []map[string]string
 
 	for _, item := range items {
-		newItem := make(map[string]string)
+		itemMap = append(itemMap, s.buildItemMap(item.doc))
+	}
+
+	sections := s.classifyItems(items, itemMap)
+
+	// build response
+
+	focusIndex := len(revItems)
+
+	res := shelfBrowseResponse{
+		Items:         itemMap,
+		StatusCode:    http.StatusOK,
+		ReverseStatus: &revStatus,
+		ForwardStatus: &fwdStatus,
+		FocusIndex:    &focusIndex,
+		MoreBefore:    revStatus.more,
+		MoreAfter:     fwdStatus.more,
+		FirstKey:      revStatus.boundaryKey,
+		LastKey:       fwdStatus.boundaryKey,
+		Sections:      sections,
+		Partial:       revStatus.StatusCode != http.StatusOK || fwdStatus.StatusCode != http.StatusOK,
+		Debug:         debug,
+		items:         items,
+		updated:       s.getIndexModified(),
+	}
+
+	if res.Partial == true {
+		s.warn("returning partial results (reverse: %d, forward: %d)", revStatus.StatusCode, fwdStatus.StatusCode)
+	}
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
+
+func (s *searchContext) buildItemMap(doc *solrDocument) map[string]string {
+	// the configured output fields of a record
+
+	newItem := make(map[string]string)
 
-		for _, field := range s.svc.config.Fields {
-			val := item.doc.getFirstString(field.Field)
+	for _, field := range s.svc.config.Fields {
+		val := doc.getFirstString(field.Field)
 
-			if val == "" && field.Name == "cover_image_url" {
-				val = s.getCoverImageURL(item.doc)
+		if field.Normalize != "" {
+			val = firstElementOf(normalizedValues(doc, field.Field, field.Normalize))
+		}
+
+		if val == "" && field.Name == fieldCoverImageURL {
+			if urls := s.getClientCoverImageURLs(doc); len(urls) > 0 {
+				val = urls[0]
+
+				if len(urls) > 1 {
+					newItem[fieldCoverImageFallbacks] = strings.Join(urls[1:], " ")
+				}
+			}
+		}
+
+		if val != "" {
+			if field.Name == "source" && val != "hathitrust" {
+				// hathitrust and uva_library are the only pools
+				// represented among shelf browse
+				val = "uva_library"
 			}
+			newItem[field.Name] = val
+		}
+	}
+
+	s.log("add response item [%v]", newItem)
+
+	return newItem
+}
+
+func (s *searchContext) browseDirection(field, key string, limit int, seen map[string]bool, debug *shelfBrowseDebug) ([]shelfBrowseItem, shelfBrowseDirectionStatus) {
+	// returns up to limit items along the shelf from the given key, nearest first,
+	// and records how the walk went in the terms stats and shelf walk metrics
+
+	span, end := s.startSpan("shelf.walk", attribute.String("shelf.field", field), attribute.String("shelf.key", key), attribute.Int("shelf.limit", limit))
+	defer end()
+
+	items, status, hits, examined := s.walkShelf(field, key, limit, seen, debug)
+
+	s.svc.termsStats.update(field, hits, examined)
+
+	s.log("%s walk: %d of %d items from %d terms (%d requested)", field, status.Returned, limit, status.TermsExamined, status.TermsRequested)
+
+	s.svc.metrics.observeWalk(field, status, s.svc.termsStats.hitRatio(field))
+
+	span.SetAttributes(
+		attribute.Int("shelf.terms_requested", status.TermsRequested),
+		attribute.Int("shelf.terms_examined", status.TermsExamined),
+		attribute.Int("shelf.returned", status.Returned),
+	)
+
+	if status.StatusCode != http.StatusOK {
+		span.SetStatus(codes.Error, status.StatusMessage)
+	}
+
+	return items, status
+}
+
+func (s *searchContext) walkShelf(field, key string, limit int, seen map[string]bool, debug *shelfBrowseDebug) ([]shelfBrowseItem, shelfBrowseDirectionStatus, int, int) {
+	// walks the shelf from the given key, returning up to limit items along with the
+	// number of keys that had matching records and the number of keys examined.
+	// terms are requested in batches sized by how many keys have typically had matching
+	// records, until enough items are found, the shelf ends, or the ceiling is reached.
+
+	var items []shelfBrowseItem
+
+	status := shelfBrowseDirectionStatus{StatusCode: http.StatusOK, Requested: limit, boundaryKey: key}
 
-			if val != "" {
-				if field.Name == "source" && val != "hathitrust" {
-					// hathitrust and uva_library are the only pools
-					// represented among shelf browse
-					val = "uva_library"
+	ceiling := s.svc.config.Solr.ShelfBrowse.MaxTerms
+
+	lower := key
+	examined := 0
+	hits := 0
+
+	// once the window is full, the walk goes on just far enough to find the next record:
+	// the shelf only continues if there is one, since keys need not have matching records
+	for status.more == false && status.TermsExamined < ceiling {
+		wanted := limit - len(items)
+		if wanted < 1 {
+			wanted = 1
+		}
+
+		count := s.svc.termsStats.batchSize(field, wanted, ceiling-status.TermsExamined)
+
+		keys, err := s.solrTerms(field, lower, count)
+		if err != nil {
+			s.err("%s walk failed: %s", field, err.Error())
+			status.StatusCode = http.StatusInternalServerError
+			status.StatusMessage = err.Error()
+			break
+		}
+
+		status.TermsRequested += count
+
+		for _, key := range keys {
+			status.TermsExamined++
+
+			item, resp := s.getItemDetails(field, key)
+
+			if resp.err != nil {
+				// keys without a matching record are expected.  anything else most likely means
+				// solr is failing, so stop rather than spend a timeout on each remaining key.
+				if resp.status != http.StatusNotFound {
+					s.err("%s walk stopped: item lookup at [%s] failed: %s", field, key, resp.err.Error())
+					status.StatusCode = http.StatusInternalServerError
+					status.StatusMessage = fmt.Sprintf("item lookup failed: %s", resp.err.Error())
+					break
+				}
+				examined++
+				continue
+			}
+
+			examined++
+			hits++
+
+			// skip records already in the window, without counting them toward the limit
+			itemID := item.doc.getFirstString("id")
+			if seen[itemID] == true {
+				if len(items) < limit {
+					s.log("skipping duplicate record [%s] at %s [%s]", itemID, field, key)
+					if debug != nil {
+						debug.Duplicates = append(debug.Duplicates, shelfBrowseDuplicate{ID: itemID, Field: field, Key: key})
+					}
 				}
-				newItem[field.Name] = val
+				continue
 			}
+
+			if len(items) >= limit {
+				status.more = true
+				break
+			}
+
+			seen[itemID] = true
+
+			items = append(items, item)
+			status.boundaryKey = key
+		}
+
+		if status.StatusCode != http.StatusOK {
+			break
 		}
 
-		s.log("add response item [%v]", newItem)
-		itemMap = append(itemMap, newItem)
+		// fewer terms than requested means we reached the end of the shelf
+		if len(keys) < count {
+			break
+		}
+
+		lower = keys[len(keys)-1]
 	}
 
-	// build response
+	// a failed walk cannot tell where the shelf ends, so assume it continues
+	if status.StatusCode != http.StatusOK {
+		status.more = true
+	}
 
-	res := shelfBrowseResponse{Items: itemMap, StatusCode: http.StatusOK}
+	status.Returned = len(items)
+	if limit > 0 {
+		status.Fill = float64(status.Returned) / float64(limit)
+	}
 
-	return searchResponse{status: http.StatusOK, data: res}
+	return items, status, hits, examined
 }
 
 func (s *searchContext) handlePingRequest() searchResponse {
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBrowseDirectionStopsOnLookupFailure(t *testing.T) {
+	var lookups atomic.Int64
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/core/terms", func(w http.ResponseWriter, r *http.Request) {
+		// plenty of keys, so that only a failure can end the walk early
+		field := r.URL.Query().Get("terms.fl")
+
+		var terms []any
+		for i := 1; i <= 50; i++ {
+			terms = append(terms, fmt.Sprintf("k%03d", i), 1)
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"responseHeader": map[string]any{"status": 0}, "terms": map[string]any{field: terms}})
+	})
+
+	mux.HandleFunc("/core/select", func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	mux.HandleFunc("/core/admin/luke", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"responseHeader":{"status":0},"index":{"version":1}}`)
+	})
+
+	solr := httptest.NewServer(mux)
+	defer solr.Close()
+
+	cfg := testConfig()
+	cfg.Solr.Host = solr.URL
+
+	svc := newTestService(t, cfg)
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	items, status := s.browseDirection(cfg.Solr.ShelfBrowse.ForwardKey, "k000", 5, map[string]bool{}, nil)
+
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("got %d item lookups, want the walk to stop after the first failure", n)
+	}
+
+	if status.StatusCode != http.StatusInternalServerError || status.StatusMessage == "" {
+		t.Errorf("got status %d [%s], want a failed walk", status.StatusCode, status.StatusMessage)
+	}
+
+	if len(items) != 0 || status.more == false {
+		t.Errorf("got %d items (more: %v), want none and the shelf assumed to continue", len(items), status.more)
+	}
+}
+
+func TestBrowseWindowBoundaries(t *testing.T) {
+	// keys without records lie before a and after e, so only records can show the shelf continues
+	shelf := newTestShelf("a", "b", "c", "d", "e")
+	shelf.orphans = []int{5, 60, 70}
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	tests := []struct {
+		id         string
+		limit      int
+		items      string
+		focus      int
+		moreBefore bool
+		moreAfter  bool
+		firstKey   string
+		lastKey    string
+	}{
+		{id: "c", limit: 1, items: "b,c,d", focus: 1, moreBefore: true, moreAfter: true, firstKey: testReverseKey(20), lastKey: testForwardKey(40)},
+		{id: "d", limit: 1, items: "c,d,e", focus: 1, moreBefore: true, moreAfter: false, firstKey: testReverseKey(30), lastKey: testForwardKey(50)},
+		{id: "a", limit: 2, items: "a,b,c", focus: 0, moreBefore: false, moreAfter: true, firstKey: testReverseKey(10), lastKey: testForwardKey(30)},
+		{id: "e", limit: 5, items: "a,b,c,d,e", focus: 4, moreBefore: false, moreAfter: false, firstKey: testReverseKey(10), lastKey: testForwardKey(50)},
+	}
+
+	for _, test := range tests {
+		s := &searchContext{svc: svc, client: &clientContext{}}
+
+		resp := s.browseItem(test.id, test.limit)
+
+		res, ok := resp.data.(shelfBrowseResponse)
+		if resp.status != http.StatusOK || ok == false {
+			t.Fatalf("%s: got %d %#v, want a window", test.id, resp.status, resp.data)
+		}
+
+		var ids []string
+		for _, item := range res.Items {
+			ids = append(ids, item["id"])
+		}
+
+		if got := strings.Join(ids, ","); got != test.items {
+			t.Errorf("%s: got items %s, want %s", test.id, got, test.items)
+		}
+
+		if res.FocusIndex == nil || *res.FocusIndex != test.focus {
+			t.Errorf("%s: got focus index %v, want %d", test.id, res.FocusIndex, test.focus)
+		}
+
+		if res.MoreBefore != test.moreBefore || res.MoreAfter != test.moreAfter {
+			t.Errorf("%s: got more before/after %v/%v, want %v/%v", test.id, res.MoreBefore, res.MoreAfter, test.moreBefore, test.moreAfter)
+		}
+
+		if res.FirstKey != test.firstKey || res.LastKey != test.lastKey {
+			t.Errorf("%s: got boundary keys %s/%s, want %s/%s", test.id, res.FirstKey, res.LastKey, test.firstKey, test.lastKey)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+const redactedValue = "[REDACTED]"
+
+// query parameters carrying credentials, which are never logged
+var credentialParams = []string{"token", coversign.SignatureParam}
+
+func redactedQuery(qp url.Values) url.Values {
+	for _, param := range credentialParams {
+		if qp.Has(param) == true {
+			qp.Set(param, redactedValue)
+		}
+	}
+
+	return qp
+}
+
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	u.RawQuery = redactedQuery(u.Query()).Encode()
+
+	return u.String()
+}
+
+// maps json paths of config values (e.g. "solr.host") to the source they were last set from
+type configSources map[string]string
+
+type configSecret struct {
+	path  string  // json path of the value within the composite config
+	env   string  // environment variable suffix; a "_FILE" variant names a file containing the value
+	value *string // location of the value within the config
+}
+
+func (s configSources) record(path string, val any, source string) {
+	// record the source for each leaf value of a decoded json config
+
+	obj, ok := val.(map[string]any)
+	if ok == false {
+		if path != "" {
+			s[path] = source
+		}
+		return
+	}
+
+	for key, child := range obj {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+
+		s.record(childPath, child, source)
+	}
+}
+
+func configValues(cfg *serviceConfig) map[string]any {
+	// the leaf values of the config, by json path
+
+	values := make(map[string]any)
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return values
+	}
+
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return values
+	}
+
+	var walk func(path string, val any)
+
+	walk = func(path string, val any) {
+		obj, ok := val.(map[string]any)
+		if ok == false {
+			if path != "" {
+				values[path] = val
+			}
+			return
+		}
+
+		for key, child := range obj {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+
+			walk(childPath, child)
+		}
+	}
+
+	walk("", raw)
+
+	return values
+}
+
+func (cfg *serviceConfig) applyDefaultsWithSources() {
+	// values that applyDefaults fills in or replaces are recorded as coming from the defaults
+
+	before := configValues(cfg)
+
+	cfg.applyDefaults()
+
+	for path, val := range configValues(cfg) {
+		if prev, ok := before[path]; ok == false || reflect.DeepEqual(prev, val) == false {
+			cfg.sources[path] = "default"
+		}
+	}
+}
+
+func (cfg *serviceConfig) secrets() []configSecret {
+	return []configSecret{
+		{path: "jwt_key", env: "JWT_KEY", value: &cfg.JWTKey},
+		{path: "solr.auth.username", env: "SOLR_USERNAME", value: &cfg.Solr.Auth.Username},
+		{path: "solr.auth.password", env: "SOLR_PASSWORD", value: &cfg.Solr.Auth.Password},
+		{path: "solr.cover_images.signing_key", env: "COVER_SIGNING_KEY", value: &cfg.Solr.CoverImages.SigningKey},
+		{path: "widget.signing_key", env: "WIDGET_SIGNING_KEY", value: &cfg.Widget.SigningKey},
+	}
+}
+
+func (cfg *serviceConfig) loadSecrets() bool {
+	// secrets can come from a file (preferred) or a dedicated environment variable.
+	// either one overrides any value that was set via json config.
+	// the values themselves are never logged.
+
+	valid := true
+
+	for _, secret := range cfg.secrets() {
+		fileEnv := envPrefix + "_" + secret.env + "_FILE"
+		valueEnv := envPrefix + "_" + secret.env
+
+		if file := os.Getenv(fileEnv); file != "" {
+			log.Printf("[CONFIG] loading %s from file %s ...", secret.path, file)
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Printf("error reading %s: %s", fileEnv, err.Error())
+				valid = false
+				continue
+			}
+
+			*secret.value = strings.TrimSpace(string(data))
+			cfg.sources[secret.path] = "file:" + file
+			continue
+		}
+
+		if val := os.Getenv(valueEnv); val != "" {
+			log.Printf("[CONFIG] loading %s from %s ...", secret.path, valueEnv)
+
+			*secret.value = val
+			cfg.sources[secret.path] = "env:" + valueEnv
+		}
+	}
+
+	return valid
+}
+
+func (cfg *serviceConfig) redacted() serviceConfig {
+	// returns a copy of the config that is safe to log or display
+
+	red := *cfg
+
+	for _, secret := range red.secrets() {
+		if *secret.value != "" {
+			*secret.value = redactedValue
+		}
+	}
+
+	return red
+}
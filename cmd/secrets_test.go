@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestLoadSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "solr_password")
+	if err := os.WriteFile(file, []byte("file-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envPrefix+"_SOLR_PASSWORD_FILE", file)
+	t.Setenv(envPrefix+"_SOLR_PASSWORD", "env-password")
+	t.Setenv(envPrefix+"_JWT_KEY", "env-jwt-key")
+
+	cfg := testConfig()
+	cfg.Solr.Auth.Username = "json-username"
+
+	if cfg.loadSecrets() == false {
+		t.Fatal("loading secrets failed")
+	}
+
+	// a file is preferred over an environment variable, and is trimmed
+	if cfg.Solr.Auth.Password != "file-password" || cfg.sources["solr.auth.password"] != "file:"+file {
+		t.Errorf("got password [%s] from [%s], want it from the file", cfg.Solr.Auth.Password, cfg.sources["solr.auth.password"])
+	}
+
+	// an environment variable overrides json config
+	if cfg.JWTKey != "env-jwt-key" || cfg.sources["jwt_key"] != "env:"+envPrefix+"_JWT_KEY" {
+		t.Errorf("got jwt key [%s] from [%s], want it from the environment", cfg.JWTKey, cfg.sources["jwt_key"])
+	}
+
+	// values without either are left alone
+	if cfg.Solr.Auth.Username != "json-username" || cfg.sources["solr.auth.username"] != "" {
+		t.Errorf("got username [%s] from [%s], want the json value", cfg.Solr.Auth.Username, cfg.sources["solr.auth.username"])
+	}
+}
+
+func TestLoadSecretsMissingFile(t *testing.T) {
+	t.Setenv(envPrefix+"_JWT_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if cfg := testConfig(); cfg.loadSecrets() == true {
+		t.Error("loading a secret from a missing file succeeded")
+	}
+}
+
+func testSecretConfig() *serviceConfig {
+	cfg := testConfig()
+
+	cfg.Solr.Auth.Username = "secret-username"
+	cfg.Solr.Auth.Password = "secret-password"
+	cfg.Solr.CoverImages.SigningKey = "secret-cover-key"
+	cfg.Widget.SigningKey = "secret-widget-key"
+
+	return cfg
+}
+
+func TestRedactedConfig(t *testing.T) {
+	cfg := testSecretConfig()
+
+	red := cfg.redacted()
+
+	for _, secret := range red.secrets() {
+		if *secret.value != redactedValue {
+			t.Errorf("got %s [%s], want it redacted", secret.path, *secret.value)
+		}
+	}
+
+	// the original is untouched
+	if cfg.JWTKey != "test-jwt-key" || cfg.Solr.Auth.Password != "secret-password" || cfg.Widget.SigningKey != "secret-widget-key" {
+		t.Error("redacting the config modified the original")
+	}
+
+	// unset secrets stay empty, so that it is clear they are not configured
+	cfg.Solr.Auth.Password = ""
+
+	if red := cfg.redacted(); red.Solr.Auth.Password != "" {
+		t.Errorf("got unset password [%s], want it empty", red.Solr.Auth.Password)
+	}
+}
+
+func TestAdminConfigHidesSecrets(t *testing.T) {
+	cfg := testSecretConfig()
+
+	svc := newTestService(t, cfg)
+	router := svc.newRouter()
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "admin", Role: v4jwt.Admin, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+
+	for _, secret := range []string{"test-jwt-key", "secret-username", "secret-password", "secret-cover-key", "secret-widget-key"} {
+		if strings.Contains(body, secret) == true {
+			t.Errorf("admin config contains secret [%s]", secret)
+		}
+	}
+
+	var res struct {
+		Config serviceConfig `json:"config"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Config.JWTKey != redactedValue || res.Config.Solr.Auth.Password != redactedValue {
+		t.Errorf("got jwt key [%s] and password [%s], want them redacted", res.Config.JWTKey, res.Config.Solr.Auth.Password)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"net/http"
 	"os"
@@ -11,6 +10,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // git commit used for this build; supplied at compile time
@@ -23,21 +24,36 @@ type serviceVersion struct {
 }
 
 type serviceSolrContext struct {
-	client *http.Client
-	url    string
+	name     string // client name, for metrics
+	client   *http.Client
+	url      string
+	username string
+	password string
 }
 
 type serviceSolr struct {
-	service     serviceSolrContext
-	healthCheck serviceSolrContext
-	shelfBrowse serviceSolrContext
+	service      serviceSolrContext
+	healthCheck  serviceSolrContext
+	shelfBrowse  serviceSolrContext
+	indexVersion serviceSolrContext // uses the healthcheck client
 }
 
 type serviceContext struct {
-	randomSource *rand.Rand
 	config       *serviceConfig
 	version      serviceVersion
 	solr         serviceSolr
+	openAPI      *openAPIDocument
+	widget       *serviceWidget
+	indexVersion *serviceIndexVersion
+	resultCache  *serviceResultCache
+	coalescing   *serviceCoalescing
+	staleStore   *lruCache
+	termsStats   *serviceTermsStats
+	lcOutline    *lcOutline
+	coverChains  []coverChain
+	coverProxy   *serviceCoverProxy
+	metrics      *serviceMetrics
+	tracer       trace.Tracer
 }
 
 type stringValidator struct {
@@ -111,31 +127,54 @@ func (p *serviceContext) initSolr() {
 	// client setup
 
 	serviceCtx := serviceSolrContext{
+		name:   "service",
 		url:    fmt.Sprintf("%s/%s/%s", p.config.Solr.Host, p.config.Solr.Core, p.config.Solr.Clients.Service.Endpoint),
 		client: httpClientWithTimeouts(p.config.Solr.Clients.Service.ConnTimeout, p.config.Solr.Clients.Service.ReadTimeout),
 	}
 
 	healthCtx := serviceSolrContext{
+		name:   "healthcheck",
 		url:    fmt.Sprintf("%s/%s/%s", p.config.Solr.Host, p.config.Solr.Core, p.config.Solr.Clients.HealthCheck.Endpoint),
 		client: httpClientWithTimeouts(p.config.Solr.Clients.HealthCheck.ConnTimeout, p.config.Solr.Clients.HealthCheck.ReadTimeout),
 	}
 
 	shelfBrowseCtx := serviceSolrContext{
+		name:   "shelf_browse",
 		url:    fmt.Sprintf("%s/%s/%s", p.config.Solr.Host, p.config.Solr.Core, p.config.Solr.Clients.ShelfBrowse.Endpoint),
 		client: httpClientWithTimeouts(p.config.Solr.Clients.ShelfBrowse.ConnTimeout, p.config.Solr.Clients.ShelfBrowse.ReadTimeout),
 	}
 
+	indexVersionCtx := serviceSolrContext{
+		name:   "index_version",
+		url:    fmt.Sprintf("%s/%s/%s", p.config.Solr.Host, p.config.Solr.Core, p.config.Caching.IndexVersionEndpoint),
+		client: healthCtx.client,
+	}
+
+	for _, ctx := range []*serviceSolrContext{&serviceCtx, &healthCtx, &shelfBrowseCtx, &indexVersionCtx} {
+		ctx.username = p.config.Solr.Auth.Username
+		ctx.password = p.config.Solr.Auth.Password
+	}
+
 	solr := serviceSolr{
-		service:     serviceCtx,
-		healthCheck: healthCtx,
-		shelfBrowse: shelfBrowseCtx,
+		service:      serviceCtx,
+		healthCheck:  healthCtx,
+		shelfBrowse:  shelfBrowseCtx,
+		indexVersion: indexVersionCtx,
 	}
 
 	p.solr = solr
 
-	log.Printf("[SERVICE] solr service url     = [%s]", serviceCtx.url)
-	log.Printf("[SERVICE] solr healthCheck url = [%s]", healthCtx.url)
-	log.Printf("[SERVICE] solr shelfBrowse url = [%s]", shelfBrowseCtx.url)
+	log.Printf("[SERVICE] solr service url      = [%s]", serviceCtx.url)
+	log.Printf("[SERVICE] solr healthCheck url  = [%s]", healthCtx.url)
+	log.Printf("[SERVICE] solr shelfBrowse url  = [%s]", shelfBrowseCtx.url)
+	log.Printf("[SERVICE] solr indexVersion url = [%s]", indexVersionCtx.url)
+}
+
+func (c *serviceSolrContext) setAuth(req *http.Request) {
+	// solr credentials are optional
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
 }
 
 func (p *serviceContext) validateConfig() {
@@ -155,6 +194,39 @@ func (p *serviceContext) validateConfig() {
 	for _, field := range p.config.Fields {
 		miscValues.requireValue(field.Name, "output field json name")
 		miscValues.requireValue(field.Field, "output field solr field")
+
+		if field.Normalize != "" && valueNormalizers[field.Normalize] == nil {
+			log.Printf("[VALIDATE] output field [%s] normalization must be one of: %s", field.Name, strings.Join(valueNormalizations(), ", "))
+			invalid = true
+		}
+	}
+
+	if sliceContainsString(widgetAuthModes, p.config.Widget.AuthMode) == false {
+		log.Printf("[VALIDATE] widget auth mode must be one of: %s", strings.Join(widgetAuthModes, ", "))
+		invalid = true
+	}
+
+	if _, err := parseLogLevel(p.config.Logging.Level); err != nil {
+		log.Printf("[VALIDATE] %s", err.Error())
+		invalid = true
+	}
+
+	if sliceContainsString(loggingFormats, p.config.Logging.Format) == false {
+		log.Printf("[VALIDATE] logging format must be one of: %s", strings.Join(loggingFormats, ", "))
+		invalid = true
+	}
+
+	if sliceContainsString(tracingExporters, p.config.Tracing.Exporter) == false {
+		log.Printf("[VALIDATE] tracing exporter must be one of: %s", strings.Join(tracingExporters, ", "))
+		invalid = true
+	}
+
+	if p.config.Tracing.Exporter == tracingExporterOTLP {
+		miscValues.requireValue(p.config.Tracing.Endpoint, "tracing endpoint")
+	}
+
+	if p.validateCoverConfig() == false {
+		invalid = true
 	}
 
 	// check if anything went wrong anywhere
@@ -169,12 +241,25 @@ func initializeService(cfg *serviceConfig) *serviceContext {
 	p := serviceContext{}
 
 	p.config = cfg
-	p.randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	p.initVersion()
+	p.initMetrics()
 	p.initSolr()
 
 	p.validateConfig()
 
+	p.initLogging()
+	p.initTracing()
+
+	p.initCaching()
+	p.initCoalescing()
+	p.initStaleStore()
+	p.initTermsStats()
+	p.initClassification()
+	p.initCovers()
+	p.initCoverProxy()
+	p.initOpenAPI()
+	p.initWidget()
+
 	return &p
 }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testConfig() *serviceConfig {
+	// a minimal valid configuration; solr is only contacted by tests that stand one in
+
+	return &serviceConfig{
+		Port:   "8080",
+		JWTKey: "test-jwt-key",
+		Solr: serviceConfigSolr{
+			Host: "http://localhost:8983",
+			Core: "core",
+			Clients: serviceConfigSolrClients{
+				Service:     serviceConfigSolrClient{Endpoint: "select", ConnTimeout: "1", ReadTimeout: "1"},
+				HealthCheck: serviceConfigSolrClient{Endpoint: "admin/ping", ConnTimeout: "1", ReadTimeout: "1"},
+				ShelfBrowse: serviceConfigSolrClient{Endpoint: "terms", ConnTimeout: "1", ReadTimeout: "1"},
+			},
+			Params: serviceConfigSolrParams{Qt: "search", DefType: "lucene"},
+			ShelfBrowse: serviceConfigSolrShelfBrowse{
+				ForwardKey:   "shelfkey",
+				ReverseKey:   "reverse_shelfkey",
+				DefaultItems: 3,
+				MaxItems:     10,
+			},
+			CoverImages: serviceConfigCoverImages{
+				URLPrefix:  "http://covers.example.edu/",
+				IDField:    "id",
+				TitleField: "title_a",
+				ISBNField:  "isbn_a",
+				PoolField:  "pool_f",
+			},
+		},
+		Fields: []serviceConfigField{
+			{Name: "id", Field: "id"},
+			{Name: "title", Field: "title_a"},
+			{Name: "call_number", Field: "call_number_a"},
+		},
+		Formats: serviceConfigFormats{
+			RecordURLPrefix: "https://search.example.edu/items/",
+			FeedURLPrefix:   "https://shelf.example.edu",
+		},
+		Logging: serviceConfigLogging{Level: "error"},
+		sources: make(configSources),
+	}
+}
+
+func newTestService(t *testing.T, cfg *serviceConfig) *serviceContext {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	cfg.applyDefaults()
+
+	return initializeService(cfg)
+}
+
+// a stand-in solr holding a single shelf.  shelved records sit at the given positions,
+// with forward keys that sort in shelf order and reverse keys that sort the opposite way.
+type testShelf struct {
+	*httptest.Server
+	positions map[string]int // shelved records, by id
+	unshelved []string       // records without shelf keys
+	orphans   []int          // positions with shelf keys but no record behind them
+	hold      chan struct{}  // if set, solr requests wait until it is closed; see holdRequests
+	mu        sync.Mutex
+	selects   map[string]int // item queries, by q
+	terms     map[string]int // terms walks, by field and lower bound
+}
+
+func testForwardKey(pos int) string {
+	return fmt.Sprintf("k%04d", pos)
+}
+
+func testReverseKey(pos int) string {
+	return fmt.Sprintf("r%04d", 9999-pos)
+}
+
+var testQueryRegex = regexp.MustCompile(`^(\w+):(?:"([^"]*)"|\((.*)\))$`)
+
+func newTestShelf(ids ...string) *testShelf {
+	// records are 10 positions apart, leaving room for orphaned keys in between
+
+	ts := &testShelf{positions: make(map[string]int), selects: make(map[string]int), terms: make(map[string]int)}
+
+	for i, id := range ids {
+		ts.positions[id] = (i + 1) * 10
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/core/select", ts.selectHandler)
+	mux.HandleFunc("/core/terms", ts.termsHandler)
+
+	mux.HandleFunc("/core/admin/luke", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"responseHeader":{"status":0},"index":{"version":1}}`)
+	})
+
+	ts.Server = httptest.NewServer(mux)
+
+	return ts
+}
+
+func (ts *testShelf) config() *serviceConfig {
+	cfg := testConfig()
+	cfg.Solr.Host = ts.URL
+
+	return cfg
+}
+
+func (ts *testShelf) holdRequests() chan struct{} {
+	// solr requests wait until the returned channel is closed
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.hold = make(chan struct{})
+
+	return ts.hold
+}
+
+func (ts *testShelf) wait() {
+	ts.mu.Lock()
+	hold := ts.hold
+	ts.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
+}
+
+func (ts *testShelf) selectCount(q string) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.selects[q]
+}
+
+func (ts *testShelf) termsCount(field, lower string) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.terms[field+":"+lower]
+}
+
+func (ts *testShelf) doc(id string) map[string]any {
+	doc := map[string]any{"id": id, "title_a": []any{"Title of " + id}, "call_number_a": []any{"QA 76 .T47"}}
+
+	if pos, ok := ts.positions[id]; ok == true {
+		doc["shelfkey"] = []any{testForwardKey(pos)}
+		doc["reverse_shelfkey"] = []any{testReverseKey(pos)}
+	}
+
+	return doc
+}
+
+func (ts *testShelf) find(field, val string) []any {
+	var docs []any
+
+	for id, pos := range ts.positions {
+		if (field == "id" && val == id) || (field == "shelfkey" && val == testForwardKey(pos)) || (field == "reverse_shelfkey" && val == testReverseKey(pos)) {
+			docs = append(docs, ts.doc(id))
+		}
+	}
+
+	for _, id := range ts.unshelved {
+		if field == "id" && val == id {
+			docs = append(docs, ts.doc(id))
+		}
+	}
+
+	return docs
+}
+
+func (ts *testShelf) selectHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Params struct {
+			Q string `json:"q"`
+		} `json:"params"`
+	}
+
+	json.NewDecoder(r.Body).Decode(&req)
+
+	ts.mu.Lock()
+	ts.selects[req.Params.Q]++
+	ts.mu.Unlock()
+
+	ts.wait()
+
+	// either field:"value", or field:("value" OR "value" ...)
+	var docs []any
+
+	if m := testQueryRegex.FindStringSubmatch(req.Params.Q); m != nil {
+		vals := []string{m[2]}
+		if m[3] != "" {
+			vals = strings.Split(strings.ReplaceAll(m[3], `"`, ""), " OR ")
+		}
+
+		for _, val := range vals {
+			docs = append(docs, ts.find(m[1], val)...)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"responseHeader": map[string]any{"status": 0},
+		"response":       map[string]any{"numFound": len(docs), "docs": docs},
+	})
+}
+
+func (ts *testShelf) termsHandler(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+
+	field := qp.Get("terms.fl")
+	lower := qp.Get("terms.lower")
+	limit, _ := strconv.Atoi(qp.Get("terms.limit"))
+
+	ts.mu.Lock()
+	ts.terms[field+":"+lower]++
+	ts.mu.Unlock()
+
+	ts.wait()
+
+	key := testForwardKey
+	if field == "reverse_shelfkey" {
+		key = testReverseKey
+	}
+
+	var keys []string
+
+	for _, pos := range ts.positions {
+		keys = append(keys, key(pos))
+	}
+
+	for _, pos := range ts.orphans {
+		keys = append(keys, key(pos))
+	}
+
+	sort.Strings(keys)
+
+	var terms []any
+
+	for _, k := range keys {
+		if k > lower && len(terms) < 2*limit {
+			terms = append(terms, k, 1)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"responseHeader": map[string]any{"status": 0}, "terms": map[string]any{field: terms}})
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type solrRequestParams struct {
@@ -56,11 +59,18 @@ type solrError struct {
 	Code     int      `json:"code,omitempty"`
 }
 
+type solrIndex struct {
+	Version      int64  `json:"version,omitempty"`
+	NumDocs      int    `json:"numDocs,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
 type solrResponse struct {
 	ResponseHeader solrResponseHeader    `json:"responseHeader,omitempty"`
 	Response       solrResponseDocuments `json:"response,omitempty"`
 	Debug          any                   `json:"debug,omitempty"`
 	Terms          map[string][]any      `json:"terms,omitempty"`
+	Index          solrIndex             `json:"index,omitempty"`
 	Error          solrError             `json:"error,omitempty"`
 	Status         string                `json:"status,omitempty"`
 	meta           *solrMeta             // pointer to struct in corresponding solrRequest
@@ -102,7 +112,7 @@ func (s *solrDocument) getFirstString(field string) string {
 	return firstElementOf(s.getStrings(field))
 }
 
-func (s *searchContext) buildSolrItemRequest(query string) {
+func (s *searchContext) buildSolrItemRequest(query string, rows int) {
 	var req solrRequest
 
 	//	req.meta.client = s.virgoReq.meta.client
@@ -113,15 +123,15 @@ func (s *searchContext) buildSolrItemRequest(query string) {
 	req.json.Params.Fq = nonemptyValues(s.svc.config.Solr.Params.Fq)
 	req.json.Params.Fl = nonemptyValues(s.svc.config.Solr.Params.Fl)
 	req.json.Params.Start = 0
-	req.json.Params.Rows = 1
+	req.json.Params.Rows = rows
 
 	s.solrReq = &req
 }
 
-func (s *searchContext) solrItemQuery(query string) error {
+func (s *searchContext) solrItemQuery(query string, rows int) (err error) {
 	ctx := s.svc.solr.service
 
-	s.buildSolrItemRequest(query)
+	s.buildSolrItemRequest(query, rows)
 
 	jsonBytes, jsonErr := json.Marshal(s.solrReq.json)
 	if jsonErr != nil {
@@ -134,7 +144,7 @@ func (s *searchContext) solrItemQuery(query string) error {
 
 	// instead, write the json to the body of the request.
 	// NOTE: Solr is lenient; GET or POST works fine for this.
-	s.log("[SOLR] query post body: %s", jsonBytes)
+	s.debug("[SOLR] query post body: %s", jsonBytes)
 	req, reqErr := http.NewRequest("POST", ctx.url, bytes.NewBuffer(jsonBytes))
 	if reqErr != nil {
 		s.log("[SOLR] NewRequest() failed: %s", reqErr.Error())
@@ -142,6 +152,11 @@ func (s *searchContext) solrItemQuery(query string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	ctx.setAuth(req)
+	req.Header.Set(requestIDHeader, s.client.reqID)
+
+	span := s.startClientSpan("solr.select", req, attribute.String("solr.client", ctx.name), attribute.String("solr.query", query), attribute.Int("solr.rows", rows))
+	defer func() { endSpanWithError(span, err) }()
 
 	if s.client.opts.verbose == true {
 		s.log("[SOLR] req: [%s]", string(jsonBytes))
@@ -153,6 +168,8 @@ func (s *searchContext) solrItemQuery(query string) error {
 	res, resErr := ctx.client.Do(req)
 	elapsedMS := int64(time.Since(start) / time.Millisecond)
 
+	s.svc.metrics.observeSolrRequest(ctx.name, start, resErr)
+
 	// external service failure logging (scenario 1)
 
 	if resErr != nil {
@@ -167,7 +184,7 @@ func (s *searchContext) solrItemQuery(query string) error {
 		}
 
 		s.log("[SOLR] client.Do() failed: %s", resErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, errMsg, elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", status, "error", errMsg)
 		return fmt.Errorf("failed to receive Solr response")
 	}
 
@@ -181,13 +198,13 @@ func (s *searchContext) solrItemQuery(query string) error {
 
 	if decErr := decoder.Decode(&solrRes); decErr != nil {
 		s.log("[SOLR] Decode() failed: %s", decErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", http.StatusInternalServerError, "error", decErr.Error())
 		return fmt.Errorf("failed to decode Solr response")
 	}
 
 	// external service success logging
 
-	s.log("Successful Solr response from %s %s. Elapsed Time: %d (ms)", req.Method, ctx.url, elapsedMS)
+	s.client.logSolr(slog.LevelInfo, "successful solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "solr_qtime", solrRes.ResponseHeader.QTime)
 
 	s.solrRes = &solrRes
 
@@ -195,6 +212,8 @@ func (s *searchContext) solrItemQuery(query string) error {
 
 	logHeader := fmt.Sprintf("[SOLR] res: header: { status = %d, QTime = %d }", solrRes.ResponseHeader.Status, solrRes.ResponseHeader.QTime)
 
+	span.SetAttributes(attribute.Int("solr.qtime", solrRes.ResponseHeader.QTime), attribute.Int("solr.num_found", solrRes.Response.NumFound))
+
 	// quick validation
 	if solrRes.ResponseHeader.Status != 0 {
 		s.log("%s, error: { code = %d, msg = %s }", logHeader, solrRes.Error.Code, solrRes.Error.Msg)
@@ -220,10 +239,15 @@ func (s *searchContext) solrPing() error {
 		return fmt.Errorf("failed to create Solr request")
 	}
 
+	ctx.setAuth(req)
+	req.Header.Set(requestIDHeader, s.client.reqID)
+
 	start := time.Now()
 	res, resErr := ctx.client.Do(req)
 	elapsedMS := int64(time.Since(start) / time.Millisecond)
 
+	s.svc.metrics.observeSolrRequest(ctx.name, start, resErr)
+
 	// external service failure logging (scenario 1)
 
 	if resErr != nil {
@@ -238,7 +262,7 @@ func (s *searchContext) solrPing() error {
 		}
 
 		s.log("[SOLR] client.Do() failed: %s", resErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, errMsg, elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", status, "error", errMsg)
 		return fmt.Errorf("failed to receive Solr response")
 	}
 
@@ -252,13 +276,13 @@ func (s *searchContext) solrPing() error {
 
 	if decErr := decoder.Decode(&solrRes); decErr != nil {
 		s.log("[SOLR] Decode() failed: %s", decErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", http.StatusInternalServerError, "error", decErr.Error())
 		return fmt.Errorf("failed to decode Solr response")
 	}
 
 	// external service success logging
 
-	s.log("Successful Solr response from %s %s. Elapsed Time: %d (ms)", req.Method, ctx.url, elapsedMS)
+	s.client.logSolr(slog.LevelInfo, "successful solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "solr_qtime", solrRes.ResponseHeader.QTime)
 
 	logHeader := fmt.Sprintf("[SOLR] res: header: { status = %d, QTime = %d }", solrRes.ResponseHeader.Status, solrRes.ResponseHeader.QTime)
 
@@ -277,7 +301,17 @@ func (s *searchContext) solrPing() error {
 	return nil
 }
 
-func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error) {
+func (s *searchContext) solrTerms(field, key string, count int) ([]string, error) {
+	// returns up to count terms following key, in index order
+
+	if s.memo != nil {
+		return s.memo.solrTerms(s, field, key, count)
+	}
+
+	return s.cachedTerms(field, key, count)
+}
+
+func (s *searchContext) solrTermsQuery(field, key string, count int) (_ []string, err error) {
 	ctx := s.svc.solr.shelfBrowse
 
 	req, reqErr := http.NewRequest("GET", ctx.url, nil)
@@ -286,20 +320,22 @@ func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error
 		return nil, fmt.Errorf("failed to create Solr request")
 	}
 
-	// request a generous buffer of extra terms, in case it turns out some don't belong to any record.
-	// this greatly increases the chance that the caller can fill the entire requested range.
-	overage := 10 * limit
-
 	qp := req.URL.Query()
 
 	qp.Add("terms.fl", field)
 	qp.Add("terms.lower", key)
 	qp.Add("terms.lower.incl", "false")
-	qp.Add("terms.limit", fmt.Sprintf("%d", overage))
+	qp.Add("terms.limit", fmt.Sprintf("%d", count))
 	qp.Add("terms.sort", "index")
 
 	req.URL.RawQuery = qp.Encode()
 
+	ctx.setAuth(req)
+	req.Header.Set(requestIDHeader, s.client.reqID)
+
+	span := s.startClientSpan("solr.terms", req, attribute.String("solr.client", ctx.name), attribute.String("shelf.field", field), attribute.String("shelf.key", key), attribute.Int("solr.terms_limit", count))
+	defer func() { endSpanWithError(span, err) }()
+
 	if s.client.opts.verbose == true {
 		s.log("SOLR: req: [%s]", req.URL.String())
 	}
@@ -308,6 +344,8 @@ func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error
 	res, resErr := ctx.client.Do(req)
 	elapsedMS := int64(time.Since(start) / time.Millisecond)
 
+	s.svc.metrics.observeSolrRequest(ctx.name, start, resErr)
+
 	// external service failure logging (scenario 1)
 
 	if resErr != nil {
@@ -322,7 +360,7 @@ func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error
 		}
 
 		s.log("SOLR: client.Do() failed: %s", resErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, status, errMsg, elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", status, "error", errMsg)
 		return nil, fmt.Errorf("failed to receive Solr response")
 	}
 
@@ -336,16 +374,18 @@ func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error
 
 	if decErr := decoder.Decode(&solrRes); decErr != nil {
 		s.log("SOLR: Decode() failed: %s", decErr.Error())
-		s.log("ERROR: Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, ctx.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", http.StatusInternalServerError, "error", decErr.Error())
 		return nil, fmt.Errorf("failed to decode Solr response")
 	}
 
 	// external service success logging
 
-	s.log("Successful Solr response from %s %s. Elapsed Time: %d (ms)", req.Method, ctx.url, elapsedMS)
+	s.client.logSolr(slog.LevelInfo, "successful solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "solr_qtime", solrRes.ResponseHeader.QTime)
 
 	logHeader := fmt.Sprintf("SOLR: res: header: { status = %d, QTime = %d }", solrRes.ResponseHeader.Status, solrRes.ResponseHeader.QTime)
 
+	span.SetAttributes(attribute.Int("solr.qtime", solrRes.ResponseHeader.QTime))
+
 	// quick validation
 	if solrRes.ResponseHeader.Status != 0 {
 		s.log("%s, error: { code = %d, msg = %s }", logHeader, solrRes.Error.Code, solrRes.Error.Msg)
@@ -363,5 +403,82 @@ func (s *searchContext) solrTerms(field, key string, limit int) ([]string, error
 		}
 	}
 
+	span.SetAttributes(attribute.Int("solr.terms_returned", len(terms)))
+
 	return terms, nil
 }
+
+func (s *searchContext) solrIndexVersion() (solrIndex, error) {
+	ctx := s.svc.solr.indexVersion
+
+	req, reqErr := http.NewRequest("GET", ctx.url, nil)
+	if reqErr != nil {
+		s.log("[SOLR] NewRequest() failed: %s", reqErr.Error())
+		return solrIndex{}, fmt.Errorf("failed to create Solr request")
+	}
+
+	qp := req.URL.Query()
+
+	qp.Add("numTerms", "0")
+	qp.Add("show", "index")
+	qp.Add("wt", "json")
+
+	req.URL.RawQuery = qp.Encode()
+
+	ctx.setAuth(req)
+	req.Header.Set(requestIDHeader, s.client.reqID)
+
+	start := time.Now()
+	res, resErr := ctx.client.Do(req)
+	elapsedMS := int64(time.Since(start) / time.Millisecond)
+
+	s.svc.metrics.observeSolrRequest(ctx.name, start, resErr)
+
+	// external service failure logging (scenario 1)
+
+	if resErr != nil {
+		status := http.StatusBadRequest
+		errMsg := resErr.Error()
+		if strings.Contains(errMsg, "Timeout") {
+			status = http.StatusRequestTimeout
+			errMsg = fmt.Sprintf("%s timed out", ctx.url)
+		} else if strings.Contains(errMsg, "connection refused") {
+			status = http.StatusServiceUnavailable
+			errMsg = fmt.Sprintf("%s refused connection", ctx.url)
+		}
+
+		s.log("[SOLR] client.Do() failed: %s", resErr.Error())
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", status, "error", errMsg)
+		return solrIndex{}, fmt.Errorf("failed to receive Solr response")
+	}
+
+	defer res.Body.Close()
+
+	var solrRes solrResponse
+
+	decoder := json.NewDecoder(res.Body)
+
+	// external service failure logging (scenario 2)
+
+	if decErr := decoder.Decode(&solrRes); decErr != nil {
+		s.log("[SOLR] Decode() failed: %s", decErr.Error())
+		s.client.logSolr(slog.LevelError, "failed solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "status", http.StatusInternalServerError, "error", decErr.Error())
+		return solrIndex{}, fmt.Errorf("failed to decode Solr response")
+	}
+
+	// external service success logging
+
+	s.client.logSolr(slog.LevelInfo, "successful solr response", ctx.name, elapsedMS, "solr_method", req.Method, "solr_url", ctx.url, "solr_qtime", solrRes.ResponseHeader.QTime)
+
+	logHeader := fmt.Sprintf("[SOLR] res: header: { status = %d, QTime = %d }", solrRes.ResponseHeader.Status, solrRes.ResponseHeader.QTime)
+
+	// quick validation
+	if solrRes.ResponseHeader.Status != 0 {
+		s.log("%s, error: { code = %d, msg = %s }", logHeader, solrRes.Error.Code, solrRes.Error.Msg)
+		return solrIndex{}, fmt.Errorf("%d - %s", solrRes.Error.Code, solrRes.Error.Msg)
+	}
+
+	s.log("%s, index version: %d", logHeader, solrRes.Index.Version)
+
+	return solrRes.Index, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the last successful browse response for an item, for use when solr is unavailable
+type staleBrowse struct {
+	res    shelfBrowseResponse
+	stored time.Time
+}
+
+func (p *serviceContext) initStaleStore() {
+	sc := p.config.Caching.Stale
+	maxAge := integerWithMinimum(sc.MaxAge, 0)
+
+	// the stale store must survive index version changes, so it is always used with version 0
+	p.staleStore = newLRUCache(sc.MaxEntries, sc.MaxBytes, time.Duration(maxAge)*time.Second)
+
+	log.Printf("[SERVICE] stale store limits     = [%d entries, %d bytes, %ds max age]", sc.MaxEntries, sc.MaxBytes, maxAge)
+}
+
+func estimatedResponseSize(res shelfBrowseResponse) int {
+	size := 128
+
+	for _, item := range res.Items {
+		for key, val := range item {
+			size += len(key) + len(val) + 32
+		}
+	}
+
+	for _, item := range res.items {
+		size += estimatedDocSize(item.doc)
+	}
+
+	return size
+}
+
+func (s *searchContext) withStaleFallback(id string, limit int, resp searchResponse) searchResponse {
+	// remember successful responses; substitute the last one when solr fails
+
+	key := id + "\x00" + strconv.Itoa(limit) + "\x00" + strconv.FormatBool(s.client.opts.debug)
+
+	res, ok := resp.data.(shelfBrowseResponse)
+
+	switch {
+	case resp.status == http.StatusOK && ok == true && res.Stale == false && res.Partial == false:
+		s.svc.staleStore.put(key, staleBrowse{res: res, stored: time.Now()}, estimatedResponseSize(res), 0)
+		return resp
+
+	case resp.status < http.StatusInternalServerError && res.Partial == false:
+		// success, or a definitive client error such as not found
+		return resp
+	}
+
+	// a partial response is still preferable to nothing, but a complete stale one is preferable to both
+
+	val, found := s.svc.staleStore.get(key, 0)
+	if found == false {
+		return resp
+	}
+
+	reason := "partial results"
+	if resp.err != nil {
+		reason = resp.err.Error()
+	}
+
+	stale := val.(staleBrowse)
+	age := int(time.Since(stale.stored) / time.Second)
+
+	s.warn("serving stale response for id [%s] (%ds old) due to: %s", id, age, reason)
+
+	staleRes := stale.res
+	staleRes.Stale = true
+	staleRes.StaleAge = age
+
+	// signed urls in the stored items may have expired since, so rebuild the items from their records
+	staleRes.Items = s.rebuildItemMaps(stale.res)
+
+	return searchResponse{status: http.StatusOK, data: staleRes}
+}
+
+func (s *searchContext) rebuildItemMaps(res shelfBrowseResponse) []map[string]string {
+	// fresh output fields for a stored response, leaving the stored maps untouched
+
+	if len(res.items) != len(res.Items) {
+		return res.Items
+	}
+
+	var itemMap []map[string]string
+
+	for _, item := range res.items {
+		itemMap = append(itemMap, s.buildItemMap(item.doc))
+	}
+
+	return itemMap
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+func newTestSolrForStale(down *atomic.Bool) *httptest.Server {
+	// a shelf holding a single item, u1; everything fails while down is set
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/core/select", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() == true {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		doc := map[string]any{"id": "u1", "title_a": []any{"A Title"}, "shelfkey": []any{"k1"}, "reverse_shelfkey": []any{"r1"}}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"responseHeader": map[string]any{"status": 0},
+			"response":       map[string]any{"numFound": 1, "docs": []any{doc}},
+		})
+	})
+
+	mux.HandleFunc("/core/terms", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() == true {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		field := r.URL.Query().Get("terms.fl")
+		json.NewEncoder(w).Encode(map[string]any{"responseHeader": map[string]any{"status": 0}, "terms": map[string]any{field: []any{}}})
+	})
+
+	mux.HandleFunc("/core/admin/luke", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"responseHeader":{"status":0},"index":{"version":1}}`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestStaleFallback(t *testing.T) {
+	var down atomic.Bool
+
+	solr := newTestSolrForStale(&down)
+	defer solr.Close()
+
+	cfg := testConfig()
+	cfg.Solr.Host = solr.URL
+
+	svc := newTestService(t, cfg)
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	browse := func(id string) searchResponse {
+		return s.withStaleFallback(id, 3, s.browseItem(id, 3))
+	}
+
+	// without a stored window, a failure is passed on as is
+
+	down.Store(true)
+
+	if resp := browse("u1"); resp.status < http.StatusInternalServerError {
+		t.Fatalf("got status %d with solr down and nothing stored, want a server error", resp.status)
+	}
+
+	// a successful response is stored, but not flagged
+
+	down.Store(false)
+
+	resp := browse("u1")
+
+	res, ok := resp.data.(shelfBrowseResponse)
+	if resp.status != http.StatusOK || ok == false || res.Stale == true || len(res.Items) != 1 {
+		t.Fatalf("got %d %#v, want a fresh response with one item", resp.status, resp.data)
+	}
+
+	// with a stored window, a failure is replaced by it, flagged as stale
+
+	down.Store(true)
+
+	resp = browse("u1")
+
+	res, ok = resp.data.(shelfBrowseResponse)
+	if resp.status != http.StatusOK || ok == false || res.Stale == false || len(res.Items) != 1 || res.Items[0]["id"] != "u1" {
+		t.Fatalf("got %d %#v, want the stored response flagged as stale", resp.status, resp.data)
+	}
+
+	if res.StaleAge < 0 {
+		t.Errorf("got stale age %d, want the age of the stored response", res.StaleAge)
+	}
+
+	// the stored window is per item and range
+
+	if resp := s.withStaleFallback("u1", 5, s.browseItem("u1", 5)); resp.status < http.StatusInternalServerError {
+		t.Errorf("got status %d for a range with nothing stored, want a server error", resp.status)
+	}
+
+	// serving a stale response does not mark the stored one as stale
+
+	val, found := svc.staleStore.get("u1\x003\x00false", 0)
+	if found == false || val.(staleBrowse).res.Stale == true {
+		t.Error("stored response is missing or was modified")
+	}
+}
+
+func TestStaleResponseResignsCoverURLs(t *testing.T) {
+	cfg := testConfig()
+	cfg.Fields = append(cfg.Fields, serviceConfigField{Name: fieldCoverImageURL, Field: "cover_x"})
+	cfg.Solr.CoverImages.SigningKey = "test-cover-key"
+	cfg.Solr.CoverImages.Proxy.PublicURL = "https://shelf-browse.example.edu"
+
+	svc := newTestService(t, cfg)
+	s := &searchContext{svc: svc, client: &clientContext{}}
+
+	key := []byte(cfg.Solr.CoverImages.SigningKey)
+
+	expired, err := coversign.Sign("https://shelf-browse.example.edu/api/cover/u1", key, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := solrDocument{"id": "u1", "title_a": []any{"A Title"}}
+	stored := map[string]string{"id": "u1", fieldCoverImageURL: expired}
+
+	res := shelfBrowseResponse{
+		Items:      []map[string]string{stored},
+		StatusCode: http.StatusOK,
+		items:      []shelfBrowseItem{{doc: &doc}},
+	}
+
+	s.withStaleFallback("u1", 0, searchResponse{status: http.StatusOK, data: res})
+
+	failed := searchResponse{status: http.StatusServiceUnavailable, err: errors.New("solr is down")}
+
+	resp := s.withStaleFallback("u1", 0, failed)
+
+	staleRes, ok := resp.data.(shelfBrowseResponse)
+	if ok == false || staleRes.Stale == false || len(staleRes.Items) != 1 {
+		t.Fatalf("got %d %#v, want a stale response with one item", resp.status, resp.data)
+	}
+
+	cover := staleRes.Items[0][fieldCoverImageURL]
+
+	if err := coversign.VerifyURL(cover, key, time.Now()); err != nil {
+		t.Errorf("stale cover url [%s] does not verify: %s", cover, err.Error())
+	}
+
+	if stored[fieldCoverImageURL] != expired {
+		t.Error("serving the stale response modified the stored item")
+	}
+}
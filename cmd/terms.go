@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	termsInitialHitRatio = 0.1  // assume one in ten shelf keys has a matching record until we learn otherwise
+	termsMinHitRatio     = 0.01 // never request more than 100x the number of items still needed
+	termsHitRatioWeight  = 0.2  // weight given to each new walk when updating the learned ratio
+	termsSafetyFactor    = 1.25 // request a few more terms than the learned ratio suggests
+	termsMinBatch        = 8
+)
+
+// learned fraction of shelf keys that have a matching record under the configured filters, per field
+type serviceTermsStats struct {
+	mu     sync.Mutex
+	ratios map[string]float64
+}
+
+func (p *serviceContext) initTermsStats() {
+	p.termsStats = &serviceTermsStats{ratios: make(map[string]float64)}
+}
+
+func (t *serviceTermsStats) hitRatio(field string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ratio, ok := t.ratios[field]; ok == true {
+		return ratio
+	}
+
+	return termsInitialHitRatio
+}
+
+func (t *serviceTermsStats) update(field string, hits, examined int) {
+	if examined == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ratio, ok := t.ratios[field]
+	if ok == false {
+		ratio = termsInitialHitRatio
+	}
+
+	ratio = (1-termsHitRatioWeight)*ratio + termsHitRatioWeight*(float64(hits)/float64(examined))
+
+	t.ratios[field] = math.Max(ratio, termsMinHitRatio)
+}
+
+func (t *serviceTermsStats) batchSize(field string, needed, remaining int) int {
+	// number of terms to request in order to (probably) find the needed items,
+	// rounded up to a power of two so that similar walks share cache entries
+
+	want := float64(needed) * termsSafetyFactor / t.hitRatio(field)
+
+	size := termsMinBatch
+	for float64(size) < want {
+		size *= 2
+	}
+
+	if size > remaining {
+		size = remaining
+	}
+
+	return size
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trace exporters
+const (
+	tracingExporterNone   = "none"
+	tracingExporterStdout = "stdout"
+	tracingExporterOTLP   = "otlp"
+)
+
+var tracingExporters = []string{tracingExporterNone, tracingExporterStdout, tracingExporterOTLP}
+
+const tracerName = "github.com/uvalib/virgo4-shelf-browse-ws"
+
+func (p *serviceContext) initTracing() {
+	cfg := p.config.Tracing
+
+	// incoming trace context is passed along to Solr, whether or not we export spans ourselves
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case tracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case tracingExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure == true {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	}
+
+	if err != nil {
+		log.Printf("[SERVICE] failed to create %s trace exporter: %s", cfg.Exporter, err.Error())
+		os.Exit(1)
+	}
+
+	if exporter != nil {
+		res := resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", p.version.BuildVersion),
+		)
+
+		// spans written to stdout are for local testing, so write them as they end
+		spanProcessor := sdktrace.WithBatcher(exporter)
+		if cfg.Exporter == tracingExporterStdout {
+			spanProcessor = sdktrace.WithSyncer(exporter)
+		}
+
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(
+			spanProcessor,
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		))
+	}
+
+	p.tracer = otel.Tracer(tracerName)
+
+	log.Printf("[SERVICE] tracing.exporter     = [%s]", cfg.Exporter)
+	log.Printf("[SERVICE] tracing.endpoint     = [%s]", cfg.Endpoint)
+	log.Printf("[SERVICE] tracing.sample_ratio = [%0.3f]", cfg.SampleRatio)
+}
+
+func (p *serviceContext) tracingHandler(c *gin.Context) {
+	// a span for each request, continuing any trace the caller started
+
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	ctx, span := p.tracer.Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", c.Request.URL.Path),
+		),
+	)
+
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+func (s *searchContext) traceContext() context.Context {
+	// the context holding the current span
+
+	if s.trace != nil {
+		return s.trace
+	}
+
+	return s.context()
+}
+
+func (s *searchContext) startSpan(name string, attrs ...attribute.KeyValue) (trace.Span, func()) {
+	// starts a child of the current span, which becomes the current span until the returned func is called
+
+	parent := s.trace
+
+	ctx, span := s.svc.tracer.Start(s.traceContext(), name, trace.WithAttributes(attrs...))
+
+	s.trace = ctx
+
+	return span, func() {
+		span.End()
+		s.trace = parent
+	}
+}
+
+func (s *searchContext) startClientSpan(name string, req *http.Request, attrs ...attribute.KeyValue) trace.Span {
+	// starts a span for an outgoing request, and passes the trace context along with it
+
+	ctx, span := s.svc.tracer.Start(s.traceContext(), name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return span
+}
+
+func endSpanWithError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -1,92 +1,107 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+	"github.com/uvalib/virgo4-shelf-browse-ws/normalize"
 )
 
-func (s *searchContext) getCoverImageURL(doc *solrDocument) string {
-	// compose a (minimal) url to the cover image service
+// record values that can be sent to the cover image service, besides identifiers
+const (
+	coverValueTitle  = "title"
+	coverValueAuthor = "author"
+)
 
-	cfg := s.svc.config.Solr.CoverImages
+func coverValues() []string {
+	return []string{coverValueTitle, coverValueAuthor, normalizeISBN, normalizeOCLC, normalizeLCCN, normalizeUPC, normalizeISSN}
+}
 
-	id := doc.getFirstString(cfg.IDField)
+func (cfg serviceConfigCoverImages) docTypeFor(doc *solrDocument) *serviceConfigCoverDocType {
+	pools := doc.getStrings(cfg.PoolField)
+	formats := doc.getStrings(cfg.FormatField)
 
-	url := cfg.URLPrefix + id
+	for i := range cfg.DocTypes {
+		if matchesAny(cfg.DocTypes[i].Pools, pools) && matchesAny(cfg.DocTypes[i].Formats, formats) {
+			return &cfg.DocTypes[i]
+		}
+	}
 
-	// also add query parameters:
-	// doc_type: music or non_music
-	// books require at least one of: isbn, oclc, lccn, upc
-	// music requires: artist_name, album_name
-	// all else is optional
+	return nil
+}
+
+func (cfg serviceConfigCoverImages) coverValue(doc *solrDocument, kind string) string {
+	switch kind {
+	case coverValueTitle:
+		return doc.getFirstString(cfg.TitleField)
+
+	case coverValueAuthor:
+		// get author from first field with a value
+		for _, field := range cfg.AuthorFields {
+			if author := doc.getFirstString(field); author != "" {
+				// remove extraneous dates, relator terms and punctuation from author
+				return normalize.Author(author)
+			}
+		}
 
-	// build query parameters using http package to properly quote values
-	req, reqErr := http.NewRequest("GET", url, nil)
-	if reqErr != nil {
 		return ""
 	}
 
-	qp := req.URL.Query()
+	return strings.Join(cfg.identifiers(doc, kind), ",")
+}
 
-	title := doc.getFirstString(cfg.TitleField)
-	poolValues := doc.getStrings(cfg.PoolField)
+// our own cover image service
+type virgoCoverProvider struct {
+	urlPrefix string
+}
 
-	// get author from first field with a value
-	authorValue := ""
-	for _, field := range cfg.AuthorFields {
-		if authorValue = doc.getFirstString(field); authorValue != "" {
-			break
-		}
-	}
+func (v *virgoCoverProvider) coverURL(cfg serviceConfigCoverImages, doc *solrDocument) (string, error) {
+	// compose a (minimal) url to the cover image service
 
-	// remove extraneous dates from author
-	author := strings.Trim(strings.Split(authorValue, "[")[0], " ")
+	id := doc.getFirstString(cfg.IDField)
 
-	if sliceContainsString(poolValues, cfg.MusicPool) == true {
-		// music
+	url := v.urlPrefix + id
 
-		qp.Add("doc_type", "music")
+	// the doc_type, and the query parameters the cover image service wants for it,
+	// come from the first doc type rule matching the record
 
-		if len(author) > 0 {
-			qp.Add("artist_name", author)
-		}
+	rule := cfg.docTypeFor(doc)
+	if rule == nil {
+		return "", nil
+	}
 
-		if len(title) > 0 {
-			qp.Add("album_name", title)
-		}
-	} else {
-		// books... and everything else
+	// build query parameters using http package to properly quote values
+	req, reqErr := http.NewRequest("GET", url, nil)
+	if reqErr != nil {
+		return "", fmt.Errorf("failed to build url: %s", reqErr.Error())
+	}
 
-		qp.Add("doc_type", "non_music")
+	qp := req.URL.Query()
+
+	qp.Add("doc_type", rule.DocType)
 
-		if len(title) > 0 {
-			qp.Add("title", title)
+	for _, param := range rule.Params {
+		if val := cfg.coverValue(doc, param.Value); val != "" {
+			qp.Add(param.Name, val)
 		}
 	}
 
-	// always throw these optional values at the cover image service
-
-	isbnValues := doc.getStrings(cfg.ISBNField)
-	if len(isbnValues) > 0 {
-		qp.Add("isbn", strings.Join(isbnValues, ","))
-	}
+	req.URL.RawQuery = qp.Encode()
 
-	oclcValues := doc.getStrings(cfg.OCLCField)
-	if len(oclcValues) > 0 {
-		qp.Add("oclc", strings.Join(oclcValues, ","))
+	if cfg.SigningKey == "" {
+		return req.URL.String(), nil
 	}
 
-	lccnValues := doc.getStrings(cfg.LCCNField)
-	if len(lccnValues) > 0 {
-		qp.Add("lccn", strings.Join(lccnValues, ","))
-	}
+	// let the cover image service tell our urls from made-up ones
+	ttl := time.Duration(integerWithMinimum(cfg.SignatureTTL, 1)) * time.Second
 
-	upcValues := doc.getStrings(cfg.UPCField)
-	if len(upcValues) > 0 {
-		qp.Add("upc", strings.Join(upcValues, ","))
+	signed, signErr := coversign.Sign(req.URL.String(), []byte(cfg.SigningKey), coversign.Expiry(time.Now(), ttl))
+	if signErr != nil {
+		return "", fmt.Errorf("failed to sign url: %s", signErr.Error())
 	}
 
-	req.URL.RawQuery = qp.Encode()
-
-	return req.URL.String()
+	return signed, nil
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type virtualShelfRequest struct {
+	IDs       []string `json:"ids"`
+	Neighbors bool     `json:"neighbors,omitempty"`
+}
+
+// the nearest records on the real shelf, on either side of an item, that are not in the list
+type virtualShelfNeighbors struct {
+	Before map[string]string `json:"before,omitempty"`
+	After  map[string]string `json:"after,omitempty"`
+}
+
+type virtualShelfResponse struct {
+	Items         []map[string]string              `json:"items,omitempty"`
+	Sections      []shelfBrowseSection             `json:"sections,omitempty"`
+	Neighbors     map[string]virtualShelfNeighbors `json:"neighbors,omitempty"`
+	Unshelved     []map[string]string              `json:"unshelved,omitempty"`
+	NotFound      []string                         `json:"not_found,omitempty"`
+	StatusCode    int                              `json:"status_code"`
+	StatusMessage string                           `json:"status_msg,omitempty"`
+	Details       []string                         `json:"details,omitempty"`
+}
+
+func solrQuoted(val string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(val) + `"`
+}
+
+func (s *searchContext) lookupItems(ids []string) (map[string]shelfBrowseItem, error) {
+	// fetches the given records in a single solr query, keyed by id
+
+	var quoted []string
+	for _, id := range ids {
+		quoted = append(quoted, solrQuoted(id))
+	}
+
+	query := fmt.Sprintf("id:(%s)", strings.Join(quoted, " OR "))
+
+	if err := s.solrItemQuery(query, len(ids)); err != nil {
+		return nil, err
+	}
+
+	cfg := s.svc.config.Solr.ShelfBrowse
+
+	items := make(map[string]shelfBrowseItem)
+
+	for i := range s.solrRes.Response.Docs {
+		doc := s.solrRes.Response.Docs[i]
+
+		item := shelfBrowseItem{
+			doc:        &doc,
+			forwardKey: doc.getFirstString(cfg.ForwardKey),
+			reverseKey: doc.getFirstString(cfg.ReverseKey),
+		}
+
+		items[doc.getFirstString("id")] = item
+	}
+
+	return items, nil
+}
+
+func (s *searchContext) handleVirtualShelfRequest() searchResponse {
+	cfg := s.svc.config.Solr.ShelfBrowse
+
+	badRequest := func(details []string) searchResponse {
+		resp := searchResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid request: %s", strings.Join(details, "; "))}
+		resp.data = virtualShelfResponse{StatusCode: resp.status, StatusMessage: "invalid request", Details: details}
+		return resp
+	}
+
+	var req virtualShelfRequest
+
+	if err := s.client.ginCtx.ShouldBindJSON(&req); err != nil {
+		return badRequest([]string{fmt.Sprintf("body: %s", err.Error())})
+	}
+
+	// validate request
+
+	var errs []string
+
+	if len(req.IDs) == 0 {
+		errs = append(errs, "ids: at least one id is required")
+	}
+
+	if len(req.IDs) > cfg.MaxVirtualIDs {
+		errs = append(errs, fmt.Sprintf("ids: %d ids is greater than the maximum of %d", len(req.IDs), cfg.MaxVirtualIDs))
+	}
+
+	// the list is a set; members are identified by id
+	listed := make(map[string]bool)
+
+	for i, id := range req.IDs {
+		switch {
+		case id == "":
+			errs = append(errs, fmt.Sprintf("ids[%d]: missing required value", i))
+
+		case listed[id] == true:
+			errs = append(errs, fmt.Sprintf("ids[%d]: duplicate id [%s]", i, id))
+		}
+
+		listed[id] = true
+	}
+
+	if len(errs) > 0 {
+		return badRequest(errs)
+	}
+
+	s.log("ids = [%d]  neighbors = [%v]", len(req.IDs), req.Neighbors)
+
+	found, err := s.lookupItems(req.IDs)
+	if err != nil {
+		s.err("query execution error: %s", err.Error())
+		resp := searchResponse{status: http.StatusInternalServerError, err: err}
+		resp.data = virtualShelfResponse{StatusCode: resp.status, StatusMessage: err.Error()}
+		return resp
+	}
+
+	// order the items as they sit on the shelf; anything without a
+	// forward shelf key has no place on it, and is returned separately
+
+	res := virtualShelfResponse{StatusCode: http.StatusOK}
+
+	var shelved []shelfBrowseItem
+
+	for _, id := range req.IDs {
+		item, ok := found[id]
+
+		switch {
+		case ok == false:
+			res.NotFound = append(res.NotFound, id)
+
+		case item.forwardKey == "":
+			res.Unshelved = append(res.Unshelved, s.buildItemMap(item.doc))
+
+		default:
+			shelved = append(shelved, item)
+		}
+	}
+
+	sort.SliceStable(shelved, func(i, j int) bool {
+		return shelved[i].forwardKey < shelved[j].forwardKey
+	})
+
+	for _, item := range shelved {
+		res.Items = append(res.Items, s.buildItemMap(item.doc))
+	}
+
+	res.Sections = s.classifyItems(shelved, res.Items)
+
+	if req.Neighbors == true {
+		res.Neighbors = s.virtualShelfNeighbors(shelved, listed)
+	}
+
+	s.log("virtual shelf: %d shelved, %d unshelved, %d not found", len(res.Items), len(res.Unshelved), len(res.NotFound))
+
+	return searchResponse{status: http.StatusOK, data: res}
+}
+
+func (s *searchContext) virtualShelfNeighbors(items []shelfBrowseItem, listed map[string]bool) map[string]virtualShelfNeighbors {
+	// nearest records on either side of each item that are not themselves in the list.
+	// neighboring items often share neighbors, so solr lookups are shared between walks.
+
+	cfg := s.svc.config.Solr.ShelfBrowse
+
+	s.memo = newSearchMemo()
+
+	neighbors := make(map[string]virtualShelfNeighbors)
+
+	nearest := func(field, key string) map[string]string {
+		if key == "" {
+			return nil
+		}
+
+		// each walk skips the listed records, but nothing else
+		seen := make(map[string]bool)
+		for id := range listed {
+			seen[id] = true
+		}
+
+		// a plain lookup: these walks are not shelf browses, so they stay out of the
+		// terms stats that size browse walks, and out of the shelf walk metrics
+		found, status, _, _ := s.walkShelf(field, key, 1, seen, nil)
+
+		if len(found) == 0 {
+			if status.StatusCode != http.StatusOK {
+				s.warn("no %s neighbor: %s", field, status.StatusMessage)
+			}
+			return nil
+		}
+
+		return s.buildItemMap(found[0].doc)
+	}
+
+	for _, item := range items {
+		id := item.doc.getFirstString("id")
+
+		neighbors[id] = virtualShelfNeighbors{
+			Before: nearest(cfg.ReverseKey, item.reverseKey),
+			After:  nearest(cfg.ForwardKey, item.forwardKey),
+		}
+	}
+
+	s.log("virtual shelf neighbors: %d shared lookups", s.memo.hits)
+
+	return neighbors
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVirtualShelfOrdersByShelfKey(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c", "d", "e", "f")
+	shelf.unshelved = []string{"u1"}
+	defer shelf.Close()
+
+	svc := newTestService(t, shelf.config())
+
+	body := `{"ids":["e","u1","b","missing","d"],"neighbors":true}`
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/virtual", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	s := &searchContext{svc: svc, client: &clientContext{ginCtx: c}}
+
+	resp := s.handleVirtualShelfRequest()
+
+	res, ok := resp.data.(virtualShelfResponse)
+	if resp.status != http.StatusOK || ok == false {
+		t.Fatalf("got %d %#v, want a virtual shelf", resp.status, resp.data)
+	}
+
+	var got []string
+	for _, item := range res.Items {
+		got = append(got, item["id"])
+	}
+
+	if strings.Join(got, ",") != "b,d,e" {
+		t.Errorf("got items %v, want them in shelf key order", got)
+	}
+
+	// records without a shelf key have no place on the shelf
+	if len(res.Unshelved) != 1 || res.Unshelved[0]["id"] != "u1" {
+		t.Errorf("got unshelved %v, want u1", res.Unshelved)
+	}
+
+	if strings.Join(res.NotFound, ",") != "missing" {
+		t.Errorf("got not found %v, want missing", res.NotFound)
+	}
+
+	if _, ok := res.Neighbors["u1"]; ok == true {
+		t.Error("got neighbors for an unshelved record")
+	}
+
+	// neighbors skip listed records, but not each other
+	want := map[string][2]string{"b": {"a", "c"}, "d": {"c", "f"}, "e": {"c", "f"}}
+
+	for id, ends := range want {
+		n := res.Neighbors[id]
+
+		if n.Before["id"] != ends[0] || n.After["id"] != ends[1] {
+			t.Errorf("got neighbors %s/%s for %s, want %s/%s", n.Before["id"], n.After["id"], id, ends[0], ends[1])
+		}
+	}
+
+	// neighbor lookups are not browses, so they should not skew what browse walks learn
+	svc.termsStats.mu.Lock()
+	defer svc.termsStats.mu.Unlock()
+
+	if len(svc.termsStats.ratios) != 0 {
+		t.Errorf("got terms stats %v from neighbor lookups, want none", svc.termsStats.ratios)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-shelf-browse-ws/coversign"
+)
+
+// widget authentication modes
+const (
+	widgetAuthNone   = "none"   // anyone may view the widget
+	widgetAuthHeader = "header" // bearer token in the Authorization header, as for /api
+	widgetAuthQuery  = "query"  // bearer token in the "token" query parameter, for use in iframes
+)
+
+var widgetAuthModes = []string{widgetAuthNone, widgetAuthHeader, widgetAuthQuery}
+
+//go:embed templates/widget.gohtml
+var widgetTemplateFS embed.FS
+
+type serviceWidget struct {
+	template     *template.Template
+	signingKey   []byte        // signs links between widget pages
+	signatureTTL time.Duration // minimum lifetime of signed links
+}
+
+type widgetItem struct {
+	ID         string
+	Title      string
+	CallNumber string
+	CoverURL   string
+	RecordURL  string
+	Current    bool
+}
+
+type widgetPage struct {
+	Title   string
+	Nonce   string
+	Message string
+	Items   []widgetItem
+	PrevURL string
+	NextURL string
+}
+
+func (p *serviceContext) initWidget() {
+	cfg := p.config.Widget
+
+	ttl := integerWithMinimum(cfg.SignatureTTL, 1)
+
+	// links between widget pages are signed with a dedicated key if configured, or else one derived from the jwt key
+	key := []byte(cfg.SigningKey)
+	if len(key) == 0 {
+		mac := hmac.New(sha256.New, []byte(p.config.JWTKey))
+		mac.Write([]byte("virgo4-shelf-browse-ws widget links"))
+		key = mac.Sum(nil)
+	}
+
+	p.widget = &serviceWidget{
+		template:     template.Must(template.ParseFS(widgetTemplateFS, "templates/widget.gohtml")),
+		signingKey:   key,
+		signatureTTL: time.Duration(ttl) * time.Second,
+	}
+
+	log.Printf("[SERVICE] widget auth mode       = [%s]", cfg.AuthMode)
+	log.Printf("[SERVICE] widget frame ancestors = [%s]", strings.Join(cfg.FrameAncestors, " "))
+	log.Printf("[SERVICE] widget link signing    = [dedicated key: %v, %ds ttl]", cfg.SigningKey != "", ttl)
+}
+
+func (p *serviceContext) widgetAuthHandler(c *gin.Context) {
+	// a signed link from another widget page stands in for a bearer token
+
+	if p.config.Widget.AuthMode == widgetAuthNone {
+		return
+	}
+
+	if sig := c.Query(coversign.SignatureParam); sig != "" {
+		if err := coversign.VerifyRequest(c.Request, p.widget.signingKey); err != nil {
+			p.auditAuth(c, authEvent{credential: authCredentialSignedURL, reason: authURLFailureReason(err), secret: sig, err: err})
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		p.auditAuth(c, authEvent{credential: authCredentialSignedURL, reason: authSuccess, secret: sig})
+		return
+	}
+
+	if p.config.Widget.AuthMode == widgetAuthQuery {
+		p.authenticateToken(c, authCredentialQuery, c.Query("token"))
+		return
+	}
+
+	p.authenticateHandler(c)
+}
+
+func (p *serviceContext) widgetURL(c *gin.Context, id string) string {
+	// link to another widget page, carrying over the range.  credentials are never copied
+	// into links; instead, links are signed so that they can be followed for a while.
+
+	qp := url.Values{}
+
+	if val := c.Query("range"); val != "" {
+		qp.Set("range", val)
+	}
+
+	link := "/widget/" + url.PathEscape(id)
+
+	if len(qp) > 0 {
+		link = link + "?" + qp.Encode()
+	}
+
+	if p.config.Widget.AuthMode == widgetAuthNone {
+		return link
+	}
+
+	signed, err := coversign.Sign(link, p.widget.signingKey, coversign.Expiry(time.Now(), p.widget.signatureTTL))
+	if err != nil {
+		return ""
+	}
+
+	return signed
+}
+
+func (s *searchContext) buildWidgetPage(resp searchResponse) widgetPage {
+	id := s.client.ginCtx.Param("id")
+
+	page := widgetPage{Title: "Items on the shelf"}
+
+	res, ok := resp.data.(shelfBrowseResponse)
+
+	switch {
+	case resp.status == http.StatusNotFound:
+		page.Message = "This item is not on the shelf."
+		return page
+
+	case resp.status != http.StatusOK || ok == false:
+		page.Message = "The shelf is not available right now."
+		return page
+	}
+
+	for _, item := range res.items {
+		itemID := item.doc.getFirstString("id")
+
+		title := s.itemField(item, fieldTitle)
+		if title == "" {
+			title = item.doc.getFirstString(s.svc.config.Solr.CoverImages.TitleField)
+		}
+
+		wi := widgetItem{
+			ID:         itemID,
+			Title:      title,
+			CallNumber: s.itemField(item, fieldCallNumber),
+			CoverURL:   s.getCoverImageURL(item.doc),
+			RecordURL:  s.svc.recordURL(itemID),
+			Current:    itemID == id,
+		}
+
+		if wi.Current == true && wi.CallNumber != "" {
+			page.Title = fmt.Sprintf("Items on the shelf near %s", wi.CallNumber)
+		}
+
+		page.Items = append(page.Items, wi)
+	}
+
+	if len(page.Items) > 0 {
+		if first := page.Items[0]; first.Current == false {
+			page.PrevURL = s.svc.widgetURL(s.client.ginCtx, first.ID)
+		}
+
+		if last := page.Items[len(page.Items)-1]; last.Current == false {
+			page.NextURL = s.svc.widgetURL(s.client.ginCtx, last.ID)
+		}
+	}
+
+	return page
+}
+
+func (s *searchContext) itemField(item shelfBrowseItem, name string) string {
+	// value of the solr field behind the named output field, if configured
+
+	for _, field := range s.svc.config.Fields {
+		if field.Name == name {
+			return item.doc.getFirstString(field.Field)
+		}
+	}
+
+	return ""
+}
+
+func widgetNonce() (string, error) {
+	// a guessable nonce would defeat the content security policy, so there is no fallback
+
+	buf := make([]byte, 16)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	// url-safe characters, which the page's nonce attributes hold unescaped
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (p *serviceContext) setWidgetHeaders(c *gin.Context, nonce string) {
+	// the widget is meant to be framed, but only by the configured sites
+
+	csp := []string{
+		"default-src 'none'",
+		"img-src * data:",
+		fmt.Sprintf("style-src 'nonce-%s'", nonce),
+		"base-uri 'none'",
+		"form-action 'none'",
+		"frame-ancestors " + strings.Join(p.config.Widget.FrameAncestors, " "),
+	}
+
+	c.Header("Content-Security-Policy", strings.Join(csp, "; "))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Referrer-Policy", "no-referrer")
+}
+
+func (p *serviceContext) widgetHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := searchContext{}
+	s.init(p, &cl)
+
+	cl.logRequest()
+
+	nonce, err := widgetNonce()
+	if err != nil {
+		cl.err("widget nonce generation failed: %s", err.Error())
+		c.String(http.StatusInternalServerError, "widget rendering failed")
+		return
+	}
+
+	p.setWidgetHeaders(c, nonce)
+
+	var resp searchResponse
+	var page widgetPage
+
+	// the widget renders its errors as a page rather than json
+	invalid := p.invalidRequest(&cl, "getShelfWidget", func(status int, errs []string) any {
+		return widgetPage{Title: "Items on the shelf", Message: "Invalid request: " + strings.Join(errs, "; ")}
+	})
+
+	if invalid != nil {
+		resp = *invalid
+		page = resp.data.(widgetPage)
+	} else {
+		resp = s.handleBrowseRequest()
+		page = s.buildWidgetPage(resp)
+	}
+
+	cl.logResponse(resp)
+
+	page.Nonce = nonce
+
+	var buf bytes.Buffer
+	if err := p.widget.template.Execute(&buf, page); err != nil {
+		cl.err("widget template execution failed: %s", err.Error())
+		c.String(http.StatusInternalServerError, "widget rendering failed")
+		return
+	}
+
+	c.Data(resp.status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+func TestWidgetDefaultsToQueryTokens(t *testing.T) {
+	shelf := newTestShelf("a", "b", "c")
+	defer shelf.Close()
+
+	cfg := shelf.config()
+
+	router := newTestService(t, cfg).newRouter()
+
+	if cfg.Widget.AuthMode != widgetAuthQuery {
+		t.Fatalf("got default auth mode [%s], want [%s]", cfg.Widget.AuthMode, widgetAuthQuery)
+	}
+
+	token, err := v4jwt.Mint(v4jwt.V4Claims{UserID: "tester", Role: v4jwt.User, AuthMethod: v4jwt.Netbadge}, time.Minute, cfg.JWTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/widget/b"); w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d without a token, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// an iframe can only pass the token in its url
+	w := get("/widget/b?range=1&token=" + token)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d with a query token, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+
+	if strings.Contains(body, token) == true {
+		t.Error("widget page contains the bearer token")
+	}
+
+	csp := w.Header().Get("Content-Security-Policy")
+
+	m := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(csp)
+
+	if m == nil || strings.Contains(body, `nonce="`+m[1]+`"`) == false {
+		t.Errorf("got policy [%s], want its nonce on the page's styles", csp)
+	}
+}
@@ -0,0 +1,187 @@
+package coversign
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("test-signing-key")
+
+const testURL = "https://covers.example.edu/u1001?doc_type=non_music&isbn=9780306406157&title=A+Book"
+
+func testSigned(t *testing.T, rawURL string, expires time.Time) string {
+	t.Helper()
+
+	signed, err := Sign(rawURL, testKey, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	signed := testSigned(t, testURL, now.Add(time.Hour))
+
+	if strings.HasPrefix(signed, "https://covers.example.edu/u1001?") == false {
+		t.Errorf("got signed url [%s], want the original location", signed)
+	}
+
+	u, _ := url.Parse(signed)
+
+	if u.Query().Get("title") != "A Book" || u.Query().Get(ExpiresParam) != "1700003600" || u.Query().Get(SignatureParam) == "" {
+		t.Errorf("got query %v, want the original parameters plus expiry and signature", u.Query())
+	}
+
+	if err := VerifyURL(signed, testKey, now); err != nil {
+		t.Errorf("got %v, want a valid url", err)
+	}
+
+	// right up to the expiry
+	if err := VerifyURL(signed, testKey, now.Add(time.Hour)); err != nil {
+		t.Errorf("got %v at the expiry time, want a valid url", err)
+	}
+
+	// the scheme and host are not signed, so proxied requests verify too
+	r := httptest.NewRequest("GET", strings.TrimPrefix(signed, "https://covers.example.edu"), nil)
+	if err := Verify(r.URL, testKey, now); err != nil {
+		t.Errorf("got %v for the request path, want a valid url", err)
+	}
+
+	// parameter order does not matter
+	reordered := *u
+	reordered.RawQuery = strings.Join(reverse(strings.Split(u.RawQuery, "&")), "&")
+	if err := Verify(&reordered, testKey, now); err != nil {
+		t.Errorf("got %v with parameters reordered, want a valid url", err)
+	}
+
+	// signing again replaces the old expiry and signature
+	resigned := testSigned(t, signed, now.Add(2*time.Hour))
+	if v, _ := url.Parse(resigned); len(v.Query()[ExpiresParam]) != 1 || len(v.Query()[SignatureParam]) != 1 {
+		t.Errorf("got re-signed query %v, want one expiry and signature", v.Query())
+	}
+	if err := VerifyURL(resigned, testKey, now.Add(90*time.Minute)); err != nil {
+		t.Errorf("got %v for a re-signed url, want a valid url", err)
+	}
+}
+
+func reverse(vals []string) []string {
+	for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+
+	return vals
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	signed := testSigned(t, testURL, now.Add(time.Hour))
+
+	tampered := func(fn func(u *url.URL)) string {
+		u, _ := url.Parse(signed)
+		fn(u)
+		return u.String()
+	}
+
+	setParam := func(name, val string) func(u *url.URL) {
+		return func(u *url.URL) {
+			qp := u.Query()
+			qp.Set(name, val)
+			u.RawQuery = qp.Encode()
+		}
+	}
+
+	delParam := func(name string) func(u *url.URL) {
+		return func(u *url.URL) {
+			qp := u.Query()
+			qp.Del(name)
+			u.RawQuery = qp.Encode()
+		}
+	}
+
+	sig, _ := url.Parse(signed)
+	validSig := sig.Query().Get(SignatureParam)
+
+	tests := []struct {
+		name string
+		url  string
+		key  []byte
+		now  time.Time
+		want error
+	}{
+		{name: "path", url: tampered(func(u *url.URL) { u.Path = "/u1002" }), want: ErrInvalidSignature},
+		{name: "query value", url: tampered(setParam("isbn", "9780804429573")), want: ErrInvalidSignature},
+		{name: "added parameter", url: tampered(setParam("size", "large")), want: ErrInvalidSignature},
+		{name: "removed parameter", url: tampered(delParam("title")), want: ErrInvalidSignature},
+		{name: "extended expiry", url: tampered(setParam(ExpiresParam, "1800000000")), want: ErrInvalidSignature},
+		{name: "signature", url: tampered(setParam(SignatureParam, strings.Repeat("0", len(validSig)))), want: ErrInvalidSignature},
+		{name: "truncated signature", url: tampered(setParam(SignatureParam, validSig[:len(validSig)-2])), want: ErrInvalidSignature},
+		{name: "wrong key", url: signed, key: []byte("some-other-key"), want: ErrInvalidSignature},
+		{name: "expired", url: signed, now: now.Add(time.Hour + time.Second), want: ErrExpired},
+		{name: "missing signature", url: tampered(delParam(SignatureParam)), want: ErrUnsigned},
+		{name: "missing expiry", url: tampered(delParam(ExpiresParam)), want: ErrUnsigned},
+		{name: "unsigned", url: testURL, want: ErrUnsigned},
+	}
+
+	for _, test := range tests {
+		key := test.key
+		if key == nil {
+			key = testKey
+		}
+
+		at := test.now
+		if at.IsZero() == true {
+			at = now
+		}
+
+		if err := VerifyURL(test.url, key, at); errors.Is(err, test.want) == false {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		now  time.Time
+		ttl  time.Duration
+		want time.Time
+	}{
+		{now: start, ttl: time.Hour, want: start.Add(2 * time.Hour)},
+		{now: start.Add(time.Second), ttl: time.Hour, want: start.Add(2 * time.Hour)},
+		{now: start.Add(59*time.Minute + 59*time.Second), ttl: time.Hour, want: start.Add(2 * time.Hour)},
+		{now: start.Add(time.Hour), ttl: time.Hour, want: start.Add(3 * time.Hour)},
+		{now: start.Add(500 * time.Millisecond), ttl: 0, want: start.Add(2 * time.Second)},
+		{now: start.Add(10 * time.Second), ttl: 300 * time.Millisecond, want: start.Add(12 * time.Second)},
+	}
+
+	for _, test := range tests {
+		got := Expiry(test.now, test.ttl)
+
+		if got.Equal(test.want) == false {
+			t.Errorf("Expiry(%s, %s): got %s, want %s", test.now.Format(time.TimeOnly), test.ttl, got.UTC().Format(time.TimeOnly), test.want.Format(time.TimeOnly))
+		}
+
+		// always at least ttl away, and never more than twice that
+		ttl := max(test.ttl, time.Second)
+		if got.Before(test.now.Add(ttl)) == true || got.After(test.now.Add(2*ttl)) == true {
+			t.Errorf("Expiry(%s, %s): got %s, want between one and two ttls away", test.now.Format(time.TimeOnly), test.ttl, got.UTC().Format(time.TimeOnly))
+		}
+	}
+
+	// urls signed within the same window are identical
+	a := testSigned(t, testURL, Expiry(start.Add(time.Minute), time.Hour))
+	b := testSigned(t, testURL, Expiry(start.Add(50*time.Minute), time.Hour))
+
+	if a != b {
+		t.Errorf("got different urls [%s] and [%s] within one window, want the same", a, b)
+	}
+}
@@ -0,0 +1,184 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// bracketed qualifiers, e.g. "Smith, John [1920-1990]"
+	authorBracketRegex = regexp.MustCompile(`\s*\[.*$`)
+
+	// the start of dates, e.g. ", 1920-1990", ", 1920-", ", -1990", ", b. 1920", ", d. 1990",
+	// ", ca. 1500-1560", ", active 1850-1900", ", 18th cent."
+	authorDatesRegex = regexp.MustCompile(`(?i),\s*(?:(?:b\.|d\.|born|died|ca\.|approximately|active|fl\.|flourished)\s*)?(?:-\s*)?(?:\d{3,4}|\d{1,2}(?:st|nd|rd|th)\s+cent(?:\.|ury))`)
+
+	// words joining several relator terms in one segment, e.g. "author and illustrator"
+	relatorJoinRegex = regexp.MustCompile(`\s+(?:and|&)\s+`)
+)
+
+// relator terms commonly found after names in headings, lowercase and without a
+// trailing period; see https://www.loc.gov/marc/relators/relaterm.html
+var relatorTerms = map[string]bool{
+	"actor":                       true,
+	"adapter":                     true,
+	"addressee":                   true,
+	"annotator":                   true,
+	"arr":                         true,
+	"arranger":                    true,
+	"artist":                      true,
+	"author":                      true,
+	"author of introduction":      true,
+	"cartographer":                true,
+	"choreographer":               true,
+	"collector":                   true,
+	"commentator":                 true,
+	"comp":                        true,
+	"compiler":                    true,
+	"composer":                    true,
+	"conductor":                   true,
+	"contributor":                 true,
+	"creator":                     true,
+	"dedicatee":                   true,
+	"degree granting institution": true,
+	"designer":                    true,
+	"director":                    true,
+	"donor":                       true,
+	"ed":                          true,
+	"eds":                         true,
+	"editor":                      true,
+	"editor of compilation":       true,
+	"engraver":                    true,
+	"film director":               true,
+	"former owner":                true,
+	"honoree":                     true,
+	"host":                        true,
+	"host institution":            true,
+	"ill":                         true,
+	"illustrator":                 true,
+	"instrumentalist":             true,
+	"interviewee":                 true,
+	"interviewer":                 true,
+	"issuing body":                true,
+	"joint author":                true,
+	"joint comp":                  true,
+	"joint ed":                    true,
+	"jt. author":                  true,
+	"jt. ed":                      true,
+	"librettist":                  true,
+	"lyricist":                    true,
+	"musician":                    true,
+	"narrator":                    true,
+	"organizer":                   true,
+	"performer":                   true,
+	"photographer":                true,
+	"printer":                     true,
+	"producer":                    true,
+	"publisher":                   true,
+	"recipient":                   true,
+	"screenwriter":                true,
+	"singer":                      true,
+	"speaker":                     true,
+	"sponsor":                     true,
+	"tr":                          true,
+	"trans":                       true,
+	"translator":                  true,
+	"vocalist":                    true,
+	"writer of added text":        true,
+	"writer of introduction":      true,
+	"writer of preface":           true,
+}
+
+// relatorSegment reports whether a comma-separated segment of a heading is a relator
+// term such as "author", "composer" or "joint ed." rather than part of the name.
+// only known terms count: lowercase segments such as the "bell" in "hooks, bell" are names.
+func relatorSegment(segment string) bool {
+	segment = strings.TrimSpace(segment)
+
+	if segment == "" {
+		return false
+	}
+
+	for _, term := range relatorJoinRegex.Split(segment, -1) {
+		term = strings.Join(strings.Fields(strings.ToLower(term)), " ")
+
+		if relatorTerms[strings.TrimSuffix(term, ".")] == false {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stripDates removes dates and everything following them from a heading.  dates within a
+// parenthetical qualifier, e.g. the "(101st, 1989-1990)" of a meeting, are part of the name.
+func stripDates(name string) string {
+	for _, loc := range authorDatesRegex.FindAllStringIndex(name, -1) {
+		before := name[:loc[0]]
+
+		if strings.Count(before, "(") > strings.Count(before, ")") {
+			continue
+		}
+
+		return before
+	}
+
+	return name
+}
+
+// trimTrailingPunctuation removes the punctuation that ends a heading in a catalog
+// record, keeping the period of a trailing initial or abbreviation such as "C. S." or "Jr."
+func trimTrailingPunctuation(name string) string {
+	name = strings.TrimRight(name, " ,;:/")
+
+	if strings.HasSuffix(name, ".") {
+		words := strings.Fields(name)
+		last := strings.TrimSuffix(words[len(words)-1], ".")
+
+		if len([]rune(last)) > 2 {
+			name = strings.TrimSuffix(name, ".")
+		}
+	}
+
+	return strings.TrimRight(name, " ,;:/")
+}
+
+// Author returns a personal or corporate name heading without dates, relator terms,
+// bracketed qualifiers or trailing punctuation, e.g. "Smith, John, 1920-1990, author."
+// becomes "Smith, John".  The name itself is left in catalog (inverted) order.
+func Author(heading string) string {
+	name := authorBracketRegex.ReplaceAllString(strings.TrimSpace(heading), "")
+	name = stripDates(name)
+	name = trimTrailingPunctuation(name)
+
+	// relator terms follow the name, possibly several of them
+	segments := strings.Split(name, ",")
+
+	for len(segments) > 1 && relatorSegment(trimTrailingPunctuation(segments[len(segments)-1])) == true {
+		segments = segments[:len(segments)-1]
+	}
+
+	return trimTrailingPunctuation(strings.Join(segments, ","))
+}
+
+// InvertName turns a name in catalog order into display order, e.g. "Smith, John"
+// becomes "John Smith", and "King, Martin Luther, Jr." becomes "Martin Luther King, Jr.".
+// Names without a comma are returned unchanged.  It cannot tell personal names from
+// corporate ones, so it should only be applied to fields holding personal names.
+func InvertName(name string) string {
+	parts := strings.Split(name, ",")
+
+	if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		return name
+	}
+
+	inverted := strings.TrimSpace(parts[1]) + " " + strings.TrimSpace(parts[0])
+
+	for _, suffix := range parts[2:] {
+		if suffix = strings.TrimSpace(suffix); suffix != "" {
+			inverted = inverted + ", " + suffix
+		}
+	}
+
+	return inverted
+}
@@ -0,0 +1,76 @@
+package normalize
+
+import (
+	"testing"
+)
+
+func TestAuthor(t *testing.T) {
+	tests := []struct {
+		heading string
+		want    string
+	}{
+		// personal names
+		{heading: "Smith, John", want: "Smith, John"},
+		{heading: "Smith, John.", want: "Smith, John"},
+		{heading: "Smith, John, author.", want: "Smith, John"},
+		{heading: "Smith, John, editor, translator.", want: "Smith, John"},
+		{heading: "Smith, John, joint ed.", want: "Smith, John"},
+		{heading: "Smith, John, author and illustrator.", want: "Smith, John"},
+		{heading: "Smith, John [Composer]", want: "Smith, John"},
+		{heading: "Lewis, C. S.", want: "Lewis, C. S."},
+		{heading: "King, Martin Luther, Jr., author.", want: "King, Martin Luther, Jr."},
+		{heading: "Homer.", want: "Homer"},
+
+		// lowercase names are not relator terms
+		{heading: "hooks, bell", want: "hooks, bell"},
+		{heading: "hooks, bell, author.", want: "hooks, bell"},
+		{heading: "cummings, e. e.", want: "cummings, e. e."},
+		{heading: "cummings, e. e. (Edward Estlin), 1894-1962, author.", want: "cummings, e. e. (Edward Estlin)"},
+
+		// dated headings
+		{heading: "Smith, John, 1920-1990", want: "Smith, John"},
+		{heading: "Smith, John, 1920-1990, author.", want: "Smith, John"},
+		{heading: "Smith, John, 1920-", want: "Smith, John"},
+		{heading: "Smith, John, -1990.", want: "Smith, John"},
+		{heading: "Smith, John, b. 1920.", want: "Smith, John"},
+		{heading: "Smith, John, ca. 1500-1560.", want: "Smith, John"},
+		{heading: "Smith, John, active 1850-1900.", want: "Smith, John"},
+		{heading: "Smith, John, 18th cent.", want: "Smith, John"},
+		{heading: "Davis, Miles, 1926-1991, performer.", want: "Davis, Miles"},
+		{heading: "Beethoven, Ludwig van, 1770-1827. Symphonies, no. 9, op. 125, D minor", want: "Beethoven, Ludwig van"},
+
+		// corporate and meeting names
+		{heading: "University of Virginia. Library, issuing body.", want: "University of Virginia. Library"},
+		{heading: "Beatles (Musical group), performer.", want: "Beatles (Musical group)"},
+		{heading: "United States. Congress (101st, 1989-1990)", want: "United States. Congress (101st, 1989-1990)"},
+		{heading: "United States. Congress (101st, 1989-1990), author.", want: "United States. Congress (101st, 1989-1990)"},
+		{heading: "Olympic Games (23rd, 1984, Los Angeles, Calif.)", want: "Olympic Games (23rd, 1984, Los Angeles, Calif.)"},
+
+		{heading: "", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := Author(test.heading); got != test.want {
+			t.Errorf("Author(%q): got %q, want %q", test.heading, got, test.want)
+		}
+	}
+}
+
+func TestInvertName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Smith, John", want: "John Smith"},
+		{name: "King, Martin Luther, Jr.", want: "Martin Luther King, Jr."},
+		{name: "hooks, bell", want: "bell hooks"},
+		{name: "Homer", want: "Homer"},
+		{name: "Smith,", want: "Smith,"},
+	}
+
+	for _, test := range tests {
+		if got := InvertName(test.name); got != test.want {
+			t.Errorf("InvertName(%q): got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package normalize canonicalizes the bibliographic values found in catalog records,
+// such as standard identifiers, so that they can be reliably compared and looked up.
+package normalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	oclcPrefixRegex = regexp.MustCompile(`(?i)^\(ocolc\)\s*`)
+	oclcNumberRegex = regexp.MustCompile(`(?i)^(?:ocm|ocn|on)?\s*0*(\d+)$`)
+	lccnRegex       = regexp.MustCompile(`^[a-z]{0,3}(?:\d{8}|\d{10})$`)
+)
+
+// leadingCode returns the leading run of characters from chars (or hyphens) in val,
+// after any label such as "ISBN", with hyphens and spaces removed.  this drops the
+// qualifiers commonly found after the code itself, e.g. "0-306-40615-2 (pbk.)".
+func leadingCode(val, label, chars string) string {
+	val = strings.ToUpper(strings.TrimSpace(val))
+
+	if label != "" && strings.HasPrefix(val, label) {
+		val = strings.TrimLeft(strings.TrimPrefix(val, label), ":- ")
+	}
+
+	end := strings.IndexFunc(val, func(r rune) bool {
+		return strings.ContainsRune(chars+"-", r) == false
+	})
+
+	if end >= 0 {
+		val = val[:end]
+	}
+
+	return strings.NewReplacer("-", "", " ", "").Replace(val)
+}
+
+func allDigits(val string) bool {
+	for _, r := range val {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return val != ""
+}
+
+// gtinCheckDigit computes the check digit for the digits of an EAN/UPC style code (GTIN)
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+
+	// weights alternate 3, 1, ... starting from the rightmost digit
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func validGTIN(code string) bool {
+	return allDigits(code) && gtinCheckDigit(code[:len(code)-1]) == code[len(code)-1]
+}
+
+func validISBN10(isbn string) bool {
+	if len(isbn) != 10 || allDigits(isbn[:9]) == false {
+		return false
+	}
+
+	sum := 0
+
+	for i := 0; i < 10; i++ {
+		d := int(isbn[i] - '0')
+		if i == 9 && isbn[i] == 'X' {
+			d = 10
+		} else if isbn[i] < '0' || isbn[i] > '9' {
+			return false
+		}
+		sum += (10 - i) * d
+	}
+
+	return sum%11 == 0
+}
+
+// ISBN10To13 converts a valid ISBN-10 to its ISBN-13 form.
+func ISBN10To13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+
+	return body + string(gtinCheckDigit(body))
+}
+
+// ISBN returns the ISBN-13 form of an ISBN-10 or ISBN-13, ignoring hyphens,
+// a leading "ISBN" label and any trailing qualifiers.  ok is false if the value is
+// not an ISBN, or its check digit is wrong.
+func ISBN(val string) (isbn string, ok bool) {
+	code := leadingCode(val, "ISBN", "0123456789X")
+
+	switch {
+	case len(code) == 10 && validISBN10(code):
+		return ISBN10To13(code), true
+
+	case len(code) == 13 && (strings.HasPrefix(code, "978") || strings.HasPrefix(code, "979")) && validGTIN(code):
+		return code, true
+	}
+
+	return "", false
+}
+
+// OCLC returns an OCLC number without its "(OCoLC)" and "ocm"/"ocn"/"on" prefixes
+// or leading zeros.  ok is false if the value is not an OCLC number.
+func OCLC(val string) (oclc string, ok bool) {
+	val = oclcPrefixRegex.ReplaceAllString(strings.TrimSpace(val), "")
+
+	m := oclcNumberRegex.FindStringSubmatch(val)
+	if m == nil || m[1] == "" {
+		return "", false
+	}
+
+	return m[1], true
+}
+
+// LCCN returns a Library of Congress Control Number in its normalized form, as
+// described at https://www.loc.gov/marc/lccn-namespace.html: lowercase prefix,
+// no blanks, no suffix, and the serial number zero-padded to six digits.
+// ok is false if the value is not an LCCN.
+func LCCN(val string) (lccn string, ok bool) {
+	val = strings.ToLower(strings.Join(strings.Fields(val), ""))
+
+	if slash := strings.Index(val, "/"); slash >= 0 {
+		val = val[:slash]
+	}
+
+	if hyphen := strings.Index(val, "-"); hyphen >= 0 {
+		serial := val[hyphen+1:]
+		if allDigits(serial) == false || len(serial) > 6 {
+			return "", false
+		}
+
+		val = val[:hyphen] + strings.Repeat("0", 6-len(serial)) + serial
+	}
+
+	if lccnRegex.MatchString(val) == false {
+		return "", false
+	}
+
+	return val, true
+}
+
+// UPC returns a 12-digit UPC-A or 13-digit EAN-13 code, ignoring hyphens, spaces and
+// any trailing qualifiers.  ok is false if the value is not such a code, or its
+// check digit is wrong.
+func UPC(val string) (upc string, ok bool) {
+	val = strings.ToUpper(strings.TrimSpace(val))
+
+	if strings.HasPrefix(val, "UPC") {
+		val = strings.TrimLeft(strings.TrimPrefix(val, "UPC"), ":- ")
+	}
+
+	// upcs are often printed in groups, e.g. "0 12345 67890 5".  groups are joined only
+	// until they make a valid code, so that numbers following one (such as a 2 or 5 digit
+	// add-on, or a quantity) are not taken as part of it.
+	code := ""
+
+	for _, group := range strings.FieldsFunc(val, func(r rune) bool { return r == ' ' || r == '-' }) {
+		digits := leadingCode(group, "", "0123456789")
+
+		if digits == "" || len(code)+len(digits) > 13 {
+			break
+		}
+
+		code += digits
+
+		if (len(code) == 12 || len(code) == 13) && validGTIN(code) {
+			return code, true
+		}
+
+		// a qualifier follows the digits
+		if len(digits) < len(group) {
+			break
+		}
+	}
+
+	return "", false
+}
+
+// ISSN returns an ISSN in its standard hyphenated form, e.g. "0317-8471", ignoring a
+// leading "ISSN" label and any trailing qualifiers.  ok is false if the value is not an
+// ISSN, or its check digit is wrong.
+func ISSN(val string) (issn string, ok bool) {
+	code := leadingCode(val, "ISSN", "0123456789X")
+
+	if len(code) != 8 || allDigits(code[:7]) == false {
+		return "", false
+	}
+
+	sum := 0
+
+	// weights run from 8 down to 2; the check digit makes the sum a multiple of 11
+	for i := 0; i < 7; i++ {
+		sum += (8 - i) * int(code[i]-'0')
+	}
+
+	check := byte('0' + (11-sum%11)%11)
+	if check == '0'+10 {
+		check = 'X'
+	}
+
+	if code[7] != check {
+		return "", false
+	}
+
+	return code[:4] + "-" + code[4:], true
+}
+
+// All normalizes each value with fn, dropping invalid values and duplicates
+// while preserving order.
+func All(vals []string, fn func(string) (string, bool)) []string {
+	var res []string
+
+	seen := make(map[string]bool)
+
+	for _, val := range vals {
+		norm, ok := fn(val)
+		if ok == false || seen[norm] == true {
+			continue
+		}
+
+		seen[norm] = true
+		res = append(res, norm)
+	}
+
+	return res
+}
@@ -0,0 +1,135 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+type normalizeTest struct {
+	val  string
+	want string
+	ok   bool
+}
+
+func testNormalizer(t *testing.T, name string, fn func(string) (string, bool), tests []normalizeTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		got, ok := fn(test.val)
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s(%q): got %q, %v; want %q, %v", name, test.val, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestISBN(t *testing.T) {
+	testNormalizer(t, "ISBN", ISBN, []normalizeTest{
+		{val: "0306406152", want: "9780306406157", ok: true},
+		{val: "0-306-40615-2", want: "9780306406157", ok: true},
+		{val: "ISBN: 0-306-40615-2 (pbk.)", want: "9780306406157", ok: true},
+		{val: "isbn 080442957x", want: "9780804429573", ok: true},
+		{val: "978-0-306-40615-7", want: "9780306406157", ok: true},
+		{val: "979-0-306-40615-6", want: "9790306406156", ok: true},
+		{val: "9790306406155", want: "", ok: false},
+		{val: "0-306-40615-3", want: "", ok: false},
+		{val: "978-0-306-40615-8", want: "", ok: false},
+		{val: "0123456789012", want: "", ok: false}, // a valid gtin, but not a book
+		{val: "030640615", want: "", ok: false},
+		{val: "03064061X2", want: "", ok: false},
+		{val: "", want: "", ok: false},
+	})
+}
+
+func TestISBN10To13(t *testing.T) {
+	for isbn10, want := range map[string]string{
+		"0306406152": "9780306406157",
+		"080442957X": "9780804429573",
+		"0000000000": "9780000000002",
+	} {
+		if got := ISBN10To13(isbn10); got != want {
+			t.Errorf("ISBN10To13(%q): got %q, want %q", isbn10, got, want)
+		}
+	}
+}
+
+func TestOCLC(t *testing.T) {
+	testNormalizer(t, "OCLC", OCLC, []normalizeTest{
+		{val: "12345", want: "12345", ok: true},
+		{val: "(OCoLC)12345", want: "12345", ok: true},
+		{val: "(OCoLC) 00012345", want: "12345", ok: true},
+		{val: "(ocolc)ocm00012345", want: "12345", ok: true},
+		{val: "ocn123456789", want: "123456789", ok: true},
+		{val: "on1234567890", want: "1234567890", ok: true},
+		{val: "OCM 12345", want: "12345", ok: true},
+		{val: "(OCoLC)", want: "", ok: false},
+		{val: "(DLC)12345", want: "", ok: false},
+		{val: "ocx12345", want: "", ok: false},
+	})
+}
+
+func TestLCCN(t *testing.T) {
+	testNormalizer(t, "LCCN", LCCN, []normalizeTest{
+		{val: "n78890351", want: "n78890351", ok: true},
+		{val: "n 78890351 ", want: "n78890351", ok: true},
+		{val: "   85000002 ", want: "85000002", ok: true},
+		{val: "sh 85026371", want: "sh85026371", ok: true},
+		{val: "n78-890351", want: "n78890351", ok: true},
+		{val: "n78-89035", want: "n78089035", ok: true},
+		{val: "85-2 ", want: "85000002", ok: true},
+		{val: "2001-000002", want: "2001000002", ok: true},
+		{val: "75-425165//r75", want: "75425165", ok: true},
+		{val: " 79139101 /AC/r932", want: "79139101", ok: true},
+		{val: "N78890351", want: "n78890351", ok: true},
+		{val: "n78-1234567", want: "", ok: false},
+		{val: "n78-89o351", want: "", ok: false},
+		{val: "abcd78890351", want: "", ok: false},
+		{val: "7889035", want: "", ok: false},
+	})
+}
+
+func TestUPC(t *testing.T) {
+	testNormalizer(t, "UPC", UPC, []normalizeTest{
+		{val: "036000291452", want: "036000291452", ok: true},
+		{val: "0 36000 29145 2", want: "036000291452", ok: true},
+		{val: "0-36000-29145-2", want: "036000291452", ok: true},
+		{val: "UPC: 036000291452", want: "036000291452", ok: true},
+		{val: "036000291452 (CD)", want: "036000291452", ok: true},
+		{val: "5 901234 123457", want: "5901234123457", ok: true},
+		{val: "5901234123457", want: "5901234123457", ok: true},
+
+		// digits following a complete code are not part of it
+		{val: "036000291452 2", want: "036000291452", ok: true},
+		{val: "0 36000 29145 2 12345", want: "036000291452", ok: true},
+		{val: "036000291452 10 discs", want: "036000291452", ok: true},
+
+		{val: "036000291453", want: "", ok: false},
+		{val: "0360002914", want: "", ok: false},
+		{val: "0123456789 0123456789", want: "", ok: false},
+		{val: "03600029145222", want: "", ok: false},
+		{val: "(CD) 036000291452", want: "", ok: false},
+		{val: "", want: "", ok: false},
+	})
+}
+
+func TestISSN(t *testing.T) {
+	testNormalizer(t, "ISSN", ISSN, []normalizeTest{
+		{val: "0317-8471", want: "0317-8471", ok: true},
+		{val: "03178471", want: "0317-8471", ok: true},
+		{val: "ISSN 0317-8471 (print)", want: "0317-8471", ok: true},
+		{val: "1050-124x", want: "1050-124X", ok: true},
+		{val: "2049-3630", want: "2049-3630", ok: true},
+		{val: "0317-8472", want: "", ok: false},
+		{val: "0317-847", want: "", ok: false},
+		{val: "0317-84711", want: "", ok: false},
+		{val: "X317-8471", want: "", ok: false},
+	})
+}
+
+func TestAll(t *testing.T) {
+	got := All([]string{"0-306-40615-2", "bogus", "9780306406157", "080442957X"}, ISBN)
+
+	if strings.Join(got, ",") != "9780306406157,9780804429573" {
+		t.Errorf("got %v, want valid isbns without duplicates, in order", got)
+	}
+}